@@ -0,0 +1,81 @@
+package gomapllrb
+
+import (
+	"golang.org/x/exp/constraints"
+)
+
+// WithArena allocates the nodes in chunks of the given number of nodes
+// instead of one by one. Deleted nodes are recycled through a free list,
+// so a tree with churn stops allocating once it reaches its peak size, and
+// Clear() keeps the chunks to fill the tree again. It cuts down the number
+// of heap objects the GC has to track. The chunks are never returned to
+// the GC until the tree is dropped.
+//
+// The iterators don't hold the recycled nodes. An iterator finds its
+// position again by the key after a delete, and stops after Clear().
+func WithArena(chunkSize int) Option {
+	return func(o *options) {
+		o.arena = chunkSize
+	}
+}
+
+// nodePool is a slab allocator of the nodes. The free nodes are linked
+// through the right pointer. The generation is increased whenever a node
+// is released, so the iterators can tell their nodes may be reused.
+type nodePool[K constraints.Ordered] struct {
+	size    int         // number of nodes in a chunk
+	chunks  [][]Node[K] // allocated chunks
+	cur     int         // index of the chunk being carved
+	next    int         // index of the next unused node in the current chunk
+	free    *Node[K]    // free list
+	gen     uint64      // generation, increased on release and reset
+	cleared uint64      // generation of the last reset
+}
+
+func newNodePool[K constraints.Ordered](size int) *nodePool[K] {
+	return &nodePool[K]{
+		size: size,
+	}
+}
+
+func (p *nodePool[K]) alloc(name K, data interface{}) *Node[K] {
+	node := p.free
+	if node != nil {
+		p.free = node.right
+		node.right = nil
+	} else {
+		if p.cur == len(p.chunks) {
+			p.chunks = append(p.chunks, make([]Node[K], p.size))
+		}
+		node = &p.chunks[p.cur][p.next]
+		if p.next++; p.next == p.size {
+			p.cur++
+			p.next = 0
+		}
+	}
+	node.name = name
+	node.data = data
+	node.red = true
+	return node
+}
+
+func (p *nodePool[K]) release(node *Node[K]) {
+	*node = Node[K]{
+		right: p.free,
+	}
+	p.free = node
+	p.gen++
+}
+
+// reset releases all the nodes. The chunks are zeroed to be carved again
+// from the first one.
+func (p *nodePool[K]) reset() {
+	for _, chunk := range p.chunks {
+		clear(chunk)
+	}
+	p.cur = 0
+	p.next = 0
+	p.free = nil
+	p.gen++
+	p.cleared = p.gen
+}
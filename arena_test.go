@@ -0,0 +1,89 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArena(t *testing.T) {
+	title("Test arena allocation")
+	assert := assert.New(t)
+
+	tree := New[int](WithArena(16))
+	for i := 0; i < 100; i++ {
+		tree.Put(i*37%100, i)
+	}
+	assertTreeCheck(t, tree, false)
+	chunks := len(tree.pool.chunks)
+	assert.Equal((tree.Len()+15)/16, chunks)
+
+	// deleted nodes are recycled
+	for i := 0; i < 50; i++ {
+		assert.True(tree.Delete(i * 37 % 100))
+		assertTreeCheck(t, tree, false)
+	}
+	for i := 0; i < 50; i++ {
+		tree.Put(i+100, i)
+	}
+	assertTreeCheck(t, tree, false)
+	assert.Equal(chunks, len(tree.pool.chunks))
+	for i := 0; i < 50; i++ {
+		assert.Equal(i, tree.Get(i+100))
+	}
+
+	// the chunks are reused after clear, and the iterators stop
+	it := tree.Iter()
+	assert.True(it.Next())
+	tree.Clear()
+	assert.Equal(chunks, len(tree.pool.chunks))
+	for i := 0; i < 100; i++ {
+		tree.Put(i+1000, i)
+	}
+	assertTreeCheck(t, tree, false)
+	assert.Equal(chunks, len(tree.pool.chunks))
+	assert.False(it.Next())
+	num := 0
+	for it := tree.Iter(); it.Next(); num++ {
+		assert.Equal(num+1000, it.Key())
+		assert.Equal(num, it.Val())
+	}
+	assert.Equal(100, num)
+}
+
+func TestArenaIterDelete(t *testing.T) {
+	title("Test iterators over the nodes recycled by the arena")
+	assert := assert.New(t)
+
+	tree := New[int](WithArena(8))
+	for i := 0; i < 20; i++ {
+		tree.Put(i, i)
+	}
+	it := tree.Iter()
+	assert.True(it.Next())
+	assert.True(it.Next())
+	assert.Equal(1, it.Key())
+	tree.Delete(2)
+	tree.Delete(3)
+	tree.Put(100, 100) // takes a deleted node
+	assert.Equal(1, it.Key())
+	assert.Equal(1, it.Val())
+	keys := []int{}
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.Equal([]int{4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 100}, keys)
+
+	// the key under the cursor deleted
+	it = tree.Range(5, 9)
+	assert.True(it.Next())
+	tree.Delete(6)
+	tree.Put(200, 200)
+	keys = []int{it.Key()}
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.Equal([]int{5, 7, 8, 9}, keys)
+}
@@ -0,0 +1,149 @@
+package gomapllrb
+
+import (
+	"errors"
+
+	"golang.org/x/exp/constraints"
+)
+
+// ErrTxnDone is returned when a transaction is used after Commit or Rollback.
+var ErrTxnDone = errors.New("transaction has already been committed or rolled back")
+
+// Batch collects Put and Delete operations to apply them atomically.
+type Batch[K constraints.Ordered] struct {
+	ops []batchOp[K]
+}
+
+type batchOp[K constraints.Ordered] struct {
+	name   K
+	data   interface{}
+	delete bool
+}
+
+// NewBatch creates a new batch.
+func NewBatch[K constraints.Ordered]() *Batch[K] {
+	return &Batch[K]{}
+}
+
+// Put appends a put operation to the batch.
+func (b *Batch[K]) Put(name K, data interface{}) {
+	b.ops = append(b.ops, batchOp[K]{name: name, data: data})
+}
+
+// Delete appends a delete operation to the batch.
+func (b *Batch[K]) Delete(name K) {
+	b.ops = append(b.ops, batchOp[K]{name: name, delete: true})
+}
+
+// Len returns the number of operations in the batch.
+func (b *Batch[K]) Len() int {
+	return len(b.ops)
+}
+
+// Reset empties the batch so it can be reused.
+func (b *Batch[K]) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Apply applies all the operations of the batch in order under a single
+// write lock, so readers never see a half-applied batch.
+func (tree *Tree[K]) Apply(b *Batch[K]) {
+	defer tree.unlockBatch(tree.lock())
+	for _, op := range b.ops {
+		if op.delete {
+			tree.deleteLocked(op.name)
+		} else {
+			tree.putLocked(op.name, op.data)
+		}
+	}
+}
+
+/*************************************************************************
+ * Transaction
+ ************************************************************************/
+
+// Txn buffers writes and applies them atomically on Commit.
+// Reads through the transaction see its own pending writes, but the
+// transaction does not isolate them from writes made by others.
+type Txn[K constraints.Ordered] struct {
+	tree    *Tree[K]
+	batch   Batch[K]
+	pending *Tree[K] // index of the last operation of the key in the batch
+	done    bool
+}
+
+// Begin starts a new transaction.
+func (tree *Tree[K]) Begin() *Txn[K] {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return &Txn[K]{
+		tree:    tree,
+		pending: tree.newKeySet(),
+	}
+}
+
+// Put buffers a put operation.
+func (txn *Txn[K]) Put(name K, data interface{}) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.pending.Put(name, txn.batch.Len())
+	txn.batch.Put(name, data)
+	return nil
+}
+
+// Delete buffers a delete operation.
+func (txn *Txn[K]) Delete(name K) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.pending.Put(name, txn.batch.Len())
+	txn.batch.Delete(name)
+	return nil
+}
+
+// Get returns the value of the key, looking at the pending writes first.
+func (txn *Txn[K]) Get(name K) interface{} {
+	data, _ := txn.lookup(name)
+	return data
+}
+
+// Exist checks if the key exists, looking at the pending writes first.
+func (txn *Txn[K]) Exist(name K) bool {
+	_, found := txn.lookup(name)
+	return found
+}
+
+// Commit applies the pending writes to the tree atomically.
+func (txn *Txn[K]) Commit() error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.done = true
+	txn.tree.Apply(&txn.batch)
+	return nil
+}
+
+// Rollback discards the pending writes.
+func (txn *Txn[K]) Rollback() error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.done = true
+	txn.batch.Reset()
+	txn.pending.Clear()
+	return nil
+}
+
+func (txn *Txn[K]) lookup(name K) (interface{}, bool) {
+	if i := txn.pending.Get(name); i != nil {
+		op := txn.batch.ops[i.(int)]
+		return op.data, !op.delete
+	}
+	txn.tree.mutex.RLock()
+	defer txn.tree.mutex.RUnlock()
+	if node := txn.tree.find(txn.tree.root, name); node != nil {
+		return node.data, true
+	}
+	return nil, false
+}
@@ -0,0 +1,94 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"cmp"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	title("Test Batch")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	tree.Put(1, 1)
+	tree.Put(2, 2)
+
+	b := NewBatch[int]()
+	b.Put(3, 3)
+	b.Put(4, 4)
+	b.Delete(1)
+	b.Put(2, 20)
+	b.Delete(4)
+	assert.Equal(5, b.Len())
+	tree.Apply(b)
+	assertTreeCheck(t, tree, false)
+
+	assert.Equal(map[int]interface{}{2: 20, 3: 3}, tree.Map())
+
+	b.Reset()
+	assert.Equal(0, b.Len())
+	tree.Apply(b)
+	assert.Equal(2, tree.Len())
+}
+
+func TestTxn(t *testing.T) {
+	title("Test Txn")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	tree.Put(1, 1)
+	tree.Put(2, 2)
+
+	// reads-your-writes
+	txn := tree.Begin()
+	assert.NoError(txn.Put(3, 3))
+	assert.NoError(txn.Delete(1))
+	assert.Equal(3, txn.Get(3))
+	assert.True(txn.Exist(3))
+	assert.Nil(txn.Get(1))
+	assert.False(txn.Exist(1))
+	assert.Equal(2, txn.Get(2))
+
+	// not visible until committed
+	assert.False(tree.Exist(3))
+	assert.True(tree.Exist(1))
+	assert.NoError(txn.Commit())
+	assert.Equal(map[int]interface{}{2: 2, 3: 3}, tree.Map())
+	assertTreeCheck(t, tree, false)
+
+	assert.ErrorIs(txn.Commit(), ErrTxnDone)
+	assert.ErrorIs(txn.Put(4, 4), ErrTxnDone)
+	assert.ErrorIs(txn.Delete(4), ErrTxnDone)
+	assert.ErrorIs(txn.Rollback(), ErrTxnDone)
+
+	// rollback
+	txn = tree.Begin()
+	assert.NoError(txn.Put(4, 4))
+	assert.NoError(txn.Rollback())
+	assert.False(tree.Exist(4))
+	assert.ErrorIs(txn.Commit(), ErrTxnDone)
+
+	// the pending writes by the comparator of the tree
+	names := New[string]()
+	names.SetCompare(func(a, b string) int { return cmp.Compare(strings.ToLower(a), strings.ToLower(b)) })
+	names.Put("key", 1)
+	txn2 := names.Begin()
+	assert.NoError(txn2.Put("KEY", 2))
+	assert.Equal(2, txn2.Get("key"))
+	assert.NoError(txn2.Delete("Key"))
+	assert.False(txn2.Exist("key"))
+	assert.NoError(txn2.Commit())
+	assert.Equal(0, names.Len())
+
+	// NaN keys
+	floats := New[float64]()
+	txn3 := floats.Begin()
+	assert.NoError(txn3.Put(math.NaN(), 1))
+	assert.Equal(1, txn3.Get(math.NaN()))
+}
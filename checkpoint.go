@@ -0,0 +1,274 @@
+package gomapllrb
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/exp/constraints"
+)
+
+// checkpoint tracks the changes since the last checkpoint. The nodes put
+// since then are marked dirty, and the keys deleted are kept in a set
+// ordered by the comparator of the tree.
+type checkpoint[K constraints.Ordered] struct {
+	dir     string
+	seq     int      // sequence number of the last checkpoint
+	full    bool     // the next one must be full, after Clear() or an error
+	deleted *Tree[K] // keys deleted since the last checkpoint
+}
+
+func newCheckpoint[K constraints.Ordered](tree *Tree[K], dir string, seq int) *checkpoint[K] {
+	return &checkpoint[K]{dir: dir, seq: seq, deleted: tree.newKeySet()}
+}
+
+// Checkpoint writes the tree to the directory. The first checkpoint of the
+// tree is a full snapshot, and the next ones are the deltas which have only
+// the keys put or deleted since the previous checkpoint.
+//
+//	checkpoint-00000001.jsonl  full snapshot
+//	delta-00000002.jsonl       changes after checkpoint-00000001.jsonl
+//	delta-00000003.jsonl       changes after delta-00000002.jsonl
+//
+// A new full snapshot is written after Clear(), on a failed checkpoint or
+// when the directory is changed, and the older files are removed then.
+// The changes are copied in memory under the write lock and written after
+// releasing it. A full snapshot walks the whole tree under the write lock,
+// while a delta visits only the paths to the dirty nodes. The checkpoints
+// of a tree must not run concurrently.
+//
+// The files are written in the format of OpRecorder, so the values must be
+// encodable in JSON. The expiration times are not saved.
+func (tree *Tree[K]) Checkpoint(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	type itemObj struct {
+		name K
+		data interface{}
+	}
+	var items []itemObj
+	var deleted *Tree[K]
+	tree.mutex.Lock()
+	c := tree.ckpt
+	full := c == nil || c.dir != dir || c.full
+	if full {
+		fulls, deltas, err := listCheckpoints(dir)
+		if err != nil {
+			tree.mutex.Unlock()
+			return err
+		}
+		seq := 0
+		if len(fulls) > 0 {
+			seq = fulls[len(fulls)-1]
+		}
+		if len(deltas) > 0 && deltas[len(deltas)-1] > seq {
+			seq = deltas[len(deltas)-1]
+		}
+		c = newCheckpoint(tree, dir, seq)
+		tree.ckpt = c
+		items = make([]itemObj, 0, tree.len)
+	}
+	// walk down only to the dirty nodes unless it's full
+	stack := make([]*Node[K], 0, 64)
+	for node := tree.root; ; {
+		for ; node != nil && (full || node.dirtySub); node = node.left {
+			stack = append(stack, node)
+		}
+		if len(stack) == 0 {
+			break
+		}
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if full || node.dirty {
+			items = append(items, itemObj{node.name, node.data})
+		}
+		node.dirty, node.dirtySub = false, false
+		node = node.right
+	}
+	if !full {
+		deleted = c.deleted
+		c.deleted = tree.newKeySet()
+	}
+	c.seq++
+	seq := c.seq
+	tree.mutex.Unlock()
+
+	kind := "delta"
+	if full {
+		kind = "checkpoint"
+	}
+	var buf bytes.Buffer
+	rec := NewOpRecorder[K](&buf, true)
+	for _, item := range items {
+		rec.record(OpLogPut, item.name, item.data)
+	}
+	if deleted != nil {
+		for it := deleted.Iter(); it.Next(); {
+			rec.record(OpLogDelete, it.Key(), nil)
+		}
+	}
+	err := rec.Err()
+	if err == nil {
+		err = writeCheckpoint(dir, walName(kind, seq), buf.Bytes())
+	}
+	if err == nil && full {
+		err = removeCheckpoints(dir, seq)
+	}
+	if err != nil {
+		// the changes are lost from the marks, so start over
+		tree.mutex.Lock()
+		if tree.ckpt == c {
+			c.full = true
+		}
+		tree.mutex.Unlock()
+	}
+	return err
+}
+
+// Restore reassembles the tree from the latest full snapshot and the deltas
+// after it written by Checkpoint(), and continues the checkpoints in the
+// directory. The tree must be empty and configured with the comparator
+// before.
+func (tree *Tree[K]) Restore(dir string) error {
+	if tree.Len() > 0 {
+		return ErrTreeNotEmpty
+	}
+	fulls, deltas, err := listCheckpoints(dir)
+	if err != nil {
+		return err
+	}
+	if len(fulls) == 0 {
+		return fmt.Errorf("%s: no checkpoint: %w", dir, fs.ErrNotExist)
+	}
+
+	base := fulls[len(fulls)-1]
+	names := []string{walName("checkpoint", base)}
+	last := base
+	for _, seq := range deltas {
+		if seq <= base {
+			continue
+		}
+		if seq != last+1 {
+			// a delta is missing, the ones after it can't be applied
+			return fmt.Errorf("%s: %s: %w", dir, walName("delta", last+1), fs.ErrNotExist)
+		}
+		names = append(names, walName("delta", seq))
+		last = seq
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = Replay(f, tree)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.ckpt = newCheckpoint(tree, dir, last)
+	return nil
+}
+
+/*************************************************************************
+ * Checkpoint functions
+ ************************************************************************/
+
+// listCheckpoints returns the sequence numbers of the full snapshots and
+// the deltas in order, and removes the temporary files left by a crash.
+func listCheckpoints(dir string) ([]int, []int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fulls, deltas []int
+	for _, e := range entries {
+		var seq int
+		if filepath.Ext(e.Name()) == ".tmp" {
+			os.Remove(filepath.Join(dir, e.Name()))
+		} else if _, err := fmt.Sscanf(e.Name(), "checkpoint-%08d.jsonl", &seq); err == nil && e.Name() == walName("checkpoint", seq) {
+			fulls = append(fulls, seq)
+		} else if _, err := fmt.Sscanf(e.Name(), "delta-%08d.jsonl", &seq); err == nil && e.Name() == walName("delta", seq) {
+			deltas = append(deltas, seq)
+		}
+	}
+	sort.Ints(fulls)
+	sort.Ints(deltas)
+	return fulls, deltas, nil
+}
+
+// removeCheckpoints removes the snapshots and the deltas before the
+// sequence.
+func removeCheckpoints(dir string, seq int) error {
+	fulls, deltas, err := listCheckpoints(dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range fulls {
+		if s < seq {
+			if err := os.Remove(filepath.Join(dir, walName("checkpoint", s))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range deltas {
+		if s < seq {
+			if err := os.Remove(filepath.Join(dir, walName("delta", s))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeCheckpoint writes the file atomically by renaming a synced
+// temporary file.
+func writeCheckpoint(dir, name string, data []byte) error {
+	tmp := filepath.Join(dir, name+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := closeFile(f); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// newKeySet returns an empty tree with the comparator of the tree.
+func (tree *Tree[K]) newKeySet() *Tree[K] {
+	set := New[K]()
+	set.isLess, set.compare = tree.isLess, tree.compare
+	return set
+}
+
+// markDirty marks the node put and the nodes above it.
+func markDirty[K constraints.Ordered](node *Node[K]) {
+	node.dirty = true
+	for ; node != nil && !node.dirtySub; node = node.up {
+		node.dirtySub = true
+	}
+}
+
+func hasDirty[K constraints.Ordered](node *Node[K]) bool {
+	return node != nil && node.dirtySub
+}
@@ -0,0 +1,149 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/constraints"
+)
+
+func TestCheckpoint(t *testing.T) {
+	title("Test Checkpoint() and Restore()")
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	files := func() []string {
+		var names []string
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+	lines := func(name string) int {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(err)
+		return bytes.Count(data, []byte("\n"))
+	}
+	restore := func() *Tree[int] {
+		restored := New[int]()
+		assert.NoError(restored.Restore(dir))
+		assert.NoError(restored.Check())
+		return restored
+	}
+
+	tree := New[int]()
+	for i := 0; i < 1000; i++ {
+		tree.Put(i, fmt.Sprint(i))
+	}
+	assert.NoError(tree.Checkpoint(dir))
+	assert.Equal([]string{"checkpoint-00000001.jsonl"}, files())
+	assert.Equal(1000, lines("checkpoint-00000001.jsonl"))
+
+	// only the changes are written
+	tree.Put(10, "updated")
+	tree.Put(2000, "new")
+	tree.Delete(20)
+	tree.Delete(30)
+	tree.Put(30, "again")
+	tree.Delete(3000) // not found
+	assert.NoError(tree.Checkpoint(dir))
+	assert.Equal(4, lines("delta-00000002.jsonl"))
+	assert.NoError(tree.Checkpoint(dir))
+	assert.Equal(0, lines("delta-00000003.jsonl"))
+	assert.Equal(tree.Map(), restore().Map())
+
+	// the dirty keys are tracked through the deletes moving the nodes
+	for i := 0; i < 10000; i++ {
+		tree.Put(int(hash32(i)%1500), fmt.Sprint(i))
+		tree.Delete(int(hash32(i+1) % 1500))
+		if i%1000 == 0 {
+			assert.True(checkDirty(tree.root))
+			assert.NoError(tree.Checkpoint(dir))
+			assert.Equal(tree.Map(), restore().Map())
+		}
+	}
+
+	// a full one after Clear()
+	tree.Clear()
+	tree.Put(1, "a")
+	assert.NoError(tree.Checkpoint(dir))
+	assert.Equal([]string{"checkpoint-00000014.jsonl"}, files())
+	assert.Equal(tree.Map(), restore().Map())
+
+	// continue from the restored one
+	restored := restore()
+	restored.Put(2, "b")
+	restored.Delete(1)
+	assert.NoError(restored.Checkpoint(dir))
+	assert.Equal([]string{"checkpoint-00000014.jsonl", "delta-00000015.jsonl"}, files())
+	assert.Equal(map[int]interface{}{2: "b"}, restore().Map())
+
+	// errors
+	assert.ErrorIs(restored.Restore(dir), ErrTreeNotEmpty)
+	assert.ErrorIs(New[int]().Restore(t.TempDir()), fs.ErrNotExist)
+	restored.Put(3, func() {})
+	assert.Error(restored.Checkpoint(dir))
+	restored.Delete(3)
+	assert.NoError(restored.Checkpoint(dir))
+	assert.Equal([]string{"checkpoint-00000016.jsonl"}, files())
+	assert.Equal(map[int]interface{}{2: "b"}, restore().Map())
+
+	// the keys equal by the comparator
+	fold := func(a, b string) int { return cmp.Compare(strings.ToLower(a), strings.ToLower(b)) }
+	sdir := t.TempDir()
+	strs := New[string]()
+	strs.SetCompare(fold)
+	strs.Put("Key", 1)
+	assert.NoError(strs.Checkpoint(sdir))
+	strs.Delete("KEY")
+	strs.Put("key", 2)
+	assert.NoError(strs.Checkpoint(sdir))
+	restoredStrs := New[string]()
+	restoredStrs.SetCompare(fold)
+	assert.NoError(restoredStrs.Restore(sdir))
+	assert.Equal(1, restoredStrs.Len())
+	assert.Equal(2.0, restoredStrs.Get("key"))
+
+	// the string keys not in UTF-8
+	strs = New[string]()
+	strs.Put("\xff", 1)
+	strs.Put("\xfe", 2)
+	assert.NoError(strs.Checkpoint(sdir))
+	strs.Delete("\xfe")
+	strs.Put("\xfd", 3)
+	assert.NoError(strs.Checkpoint(sdir))
+	restoredStrs = New[string]()
+	assert.NoError(restoredStrs.Restore(sdir))
+	assert.Equal(map[string]interface{}{"\xfd": 3.0, "\xff": 1.0}, restoredStrs.Map())
+
+	// a gap in the deltas
+	restored.Put(4, "d")
+	assert.NoError(restored.Checkpoint(dir))
+	restored.Put(5, "e")
+	assert.NoError(restored.Checkpoint(dir))
+	assert.NoError(os.Remove(filepath.Join(dir, "delta-00000017.jsonl")))
+	err := New[int]().Restore(dir)
+	assert.ErrorIs(err, fs.ErrNotExist)
+	assert.ErrorContains(err, "delta-00000017.jsonl")
+}
+
+// checkDirty checks the nodes above the dirty ones are marked.
+func checkDirty[K constraints.Ordered](node *Node[K]) bool {
+	if node == nil {
+		return true
+	}
+	if (node.dirty || hasDirty(node.left) || hasDirty(node.right)) && !node.dirtySub {
+		return false
+	}
+	return checkDirty(node.left) && checkDirty(node.right)
+}
@@ -0,0 +1,83 @@
+// Command llrbreplay replays an operation log recorded by OpRecorder and
+// runs Check() after each step. It reports the first failing step.
+//
+//	$ llrbreplay -key int ops.jsonl
+//	replayed 1000 steps, len 420
+//
+// Copyright (c) 2023, Seungyoung Kim
+// https://github.com/wolkykim/GoMapLLRB
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wolkykim/gomapllrb"
+	"golang.org/x/exp/constraints"
+)
+
+func main() {
+	key := flag.String("key", "string", "key type: string, int or float64")
+	verbose := flag.Bool("v", false, "print each step")
+	printTree := flag.Bool("print", false, "print the tree at the end")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] [log file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*key, flag.Arg(0), *verbose, *printTree); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run replays the log file, or the standard input if the path is empty,
+// with the key type.
+func run(key, path string, verbose, printTree bool) error {
+	in := io.Reader(os.Stdin)
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	switch key {
+	case "string":
+		return replay[string](in, os.Stdout, verbose, printTree)
+	case "int":
+		return replay[int](in, os.Stdout, verbose, printTree)
+	case "float64":
+		return replay[float64](in, os.Stdout, verbose, printTree)
+	}
+	return fmt.Errorf("unknown key type %q", key)
+}
+
+// replay replays the log and checks the tree after each step.
+func replay[K constraints.Ordered](in io.Reader, out io.Writer, verbose, printTree bool) error {
+	tree := gomapllrb.New[K]()
+	steps := 0
+	err := gomapllrb.ReplayFunc(in, tree, func(step int, rec gomapllrb.OpRecord[K]) error {
+		steps = step
+		if verbose {
+			fmt.Fprintf(out, "#%d %s %v\n", step, rec.Op, rec.Key)
+		}
+		if err := tree.Check(); err != nil {
+			return fmt.Errorf("%s %v: %w", rec.Op, rec.Key, err)
+		}
+		return nil
+	})
+	if printTree {
+		fmt.Fprint(out, tree)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "replayed %d steps, len %d\n", steps, tree.Len())
+	return nil
+}
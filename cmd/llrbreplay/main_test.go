@@ -0,0 +1,50 @@
+//go:build !bench
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	log := `{"op":"put","key":"A"}` + "\n" +
+		`{"op":"put","key":"B"}` + "\n" +
+		`{"op":"delete","key":"A"}` + "\n"
+	assert.NoError(replay[string](strings.NewReader(log), &out, true, true))
+	assert.Equal(""+
+		"#1 put A\n"+
+		"#2 put B\n"+
+		"#3 delete A\n"+
+		"B \n"+
+		"replayed 3 steps, len 1\n", out.String())
+
+	out.Reset()
+	raw := `{"op":"put","key_raw":"/w=="}` + "\n" +
+		`{"op":"put","key_raw":"/g=="}` + "\n"
+	assert.NoError(replay[string](strings.NewReader(raw), &out, false, false))
+	assert.Equal("replayed 2 steps, len 2\n", out.String())
+
+	out.Reset()
+	assert.EqualError(replay[int](strings.NewReader(log), &out, false, false),
+		"step 1: json: cannot unmarshal string into Go struct field opLine[int].key of type int")
+	assert.Empty(out.String())
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "ops.jsonl")
+	assert.NoError(os.WriteFile(path, []byte(`{"op":"put","key":1}`+"\n"), 0644))
+	assert.NoError(run("int", path, false, false))
+	assert.EqualError(run("bool", path, false, false), `unknown key type "bool"`)
+	assert.ErrorIs(run("int", path+".none", false, false), os.ErrNotExist)
+}
@@ -0,0 +1,836 @@
+package gomapllrb
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/exp/constraints"
+)
+
+// CompactTree is an alternative storage backend of Tree which keeps the
+// nodes in a slice and links them with uint32 indices instead of pointers.
+// The color bit is packed into the parent index and the values are kept
+// in a separate slice, so the node slice has no pointers for scalar keys
+// and the GC doesn't need to scan it. It exposes the same API as Tree for
+// the basic operations and can hold up to 2^31-1 keys. Put panics beyond.
+//
+//	Tree:        name + data(16) + red(8) + up/left/right(24) bytes per key
+//	CompactTree: name + data(16) + up/left/right(12) bytes per key
+type CompactTree[K constraints.Ordered] struct {
+	isLess  Comparator[K]  // data comparator (default: IsLess)
+	compare CompareFunc[K] // three-way comparator (default: cmp.Compare)
+
+	nodes   []compactNode[K] // nodes[0] is the nil sentinel
+	datas   []interface{}    // values indexed by the node index
+	root    uint32           // root node index
+	free    uint32           // free list of deleted nodes linked by right
+	len     int              // number of object stored
+	gen     uint64           // generation of the nodes, increased on release and Clear()
+	cleared uint64           // generation of the last Clear()
+	mutex   sync.RWMutex     // reader/writer mutual exclusion lock
+
+	stats Stats     // usage and performance metrics
+	steps PerfStats // rotations and flips of the write in progress
+}
+
+type compactNode[K constraints.Ordered] struct {
+	name  K
+	up    uint32 // parent index, the top bit is set if the node is red
+	left  uint32
+	right uint32
+}
+
+const compactRed = uint32(1) << 31
+
+// NewCompact creates a new compact tree.
+func NewCompact[K constraints.Ordered]() *CompactTree[K] {
+	return &CompactTree[K]{
+		isLess:  IsLess[K],
+		compare: cmp.Compare[K],
+		nodes:   make([]compactNode[K], 1),
+		datas:   make([]interface{}, 1),
+	}
+}
+
+// SetLess sets a user comparator function.
+func (tree *CompactTree[K]) SetLess(fn Comparator[K]) {
+	tree.isLess = fn
+	tree.compare = lessToCompare(fn)
+}
+
+// SetCompare sets a user three-way comparator function.
+func (tree *CompactTree[K]) SetCompare(fn CompareFunc[K]) {
+	tree.compare = fn
+	tree.isLess = compareToLess(fn)
+}
+
+// Put inserts a new key or replaces old if the same key is found.
+func (tree *CompactTree[K]) Put(name K, data interface{}) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.put(name, data)
+	tree.setRed(tree.root, false)
+}
+
+// Delete deletes the key. It returns false if the key is not found.
+func (tree *CompactTree[K]) Delete(name K) bool {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	deleted := tree.delete(name)
+	tree.setRed(tree.root, false)
+	if deleted {
+		tree.stats.Delete.Deleted++
+	} else {
+		tree.stats.Delete.NotFound++
+	}
+	return deleted
+}
+
+// Get returns the value of the key. If key is not found, it returns Nil.
+// When Nil value is expected as a actual value, use Exist() instead.
+func (tree *CompactTree[K]) Get(name K) interface{} {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	if i := tree.get(name); i != 0 {
+		return tree.datas[i]
+	}
+	return nil
+}
+
+// Exist checks if the key exists.
+func (tree *CompactTree[K]) Exist(name K) bool {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.get(name) != 0
+}
+
+// Min returns a min key and value.
+func (tree *CompactTree[K]) Min() (K, interface{}, bool) {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.entry(tree.findMin(tree.root))
+}
+
+// Max returns a max key and value.
+func (tree *CompactTree[K]) Max() (K, interface{}, bool) {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.entry(tree.findMax(tree.root))
+}
+
+// Bigger finds the next key bigger than given key.
+func (tree *CompactTree[K]) Bigger(name K) (K, interface{}, bool) {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.entry(tree.bigger(tree.root, name, false))
+}
+
+// Smaller finds the next key smaller than given key.
+func (tree *CompactTree[K]) Smaller(name K) (K, interface{}, bool) {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.entry(tree.smaller(tree.root, name, false))
+}
+
+// EqualOrBigger finds a matching key or the next bigger key.
+func (tree *CompactTree[K]) EqualOrBigger(name K) (K, interface{}, bool) {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.entry(tree.bigger(tree.root, name, true))
+}
+
+// EqualOrSmaller finds a matching key or the next smaller key.
+func (tree *CompactTree[K]) EqualOrSmaller(name K) (K, interface{}, bool) {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.entry(tree.smaller(tree.root, name, true))
+}
+
+// Clear empties the tree without resetting the statistic metrics.
+func (tree *CompactTree[K]) Clear() {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.nodes = make([]compactNode[K], 1)
+	tree.datas = make([]interface{}, 1)
+	tree.root = 0
+	tree.free = 0
+	tree.len = 0
+	tree.gen++
+	tree.cleared = tree.gen
+}
+
+// Len returns the number of object stored.
+func (tree *CompactTree[K]) Len() int {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.len
+}
+
+// Stats returns a copy of the statistics metrics.
+func (tree *CompactTree[K]) Stats() Stats {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.stats.snapshot()
+}
+
+// ResetStats resets all the satistics metrics.
+func (tree *CompactTree[K]) ResetStats() {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.stats = Stats{Perf: loadPerf()}
+}
+
+// String returns a pretty drawing of the tree structure.
+func (tree *CompactTree[K]) String() string {
+	var buf bytes.Buffer
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	tree.printNode(&buf)
+	return buf.String()
+}
+
+// Map returns the tree in a map
+func (tree *CompactTree[K]) Map() map[K]interface{} {
+	m := make(map[K]interface{}, tree.Len())
+	for it := tree.Iter(); it.Next(); {
+		m[it.Key()] = it.Val()
+	}
+	return m
+}
+
+// Check checks that the invariants of the red-black tree are satisfied.
+// See Tree.Check() for the details.
+func (tree *CompactTree[K]) Check() error {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	if tree.isRed(tree.root) {
+		return ErrRootProperty
+	}
+	return tree.check()
+}
+
+/*************************************************************************
+ * Iterator
+ ************************************************************************/
+
+// CompactIter is a iterator object of CompactTree. The node indexes are
+// reused, so it finds its position again by the key after a delete, and
+// stops after Clear().
+type CompactIter[K constraints.Ordered] struct {
+	tree *CompactTree[K]
+	gen  uint64      // generation of the nodes the cursor is in
+	cur  uint32      // cursor, start from
+	key  K           // key of the cursor, to find it again
+	name K           // last key after Next()
+	data interface{} // last value after Next()
+	end  K           // end boundary is span is set
+	span bool        // indicates the end boundary is set
+	done bool        // indicates the iteration is complete
+}
+
+// Iter returns an iterator.
+func (tree *CompactTree[K]) Iter() *CompactIter[K] {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	it := &CompactIter[K]{
+		tree: tree,
+		cur:  tree.findMin(tree.root),
+	}
+	it.track()
+	return it
+}
+
+// Range returns a ranged iterator.
+func (tree *CompactTree[K]) Range(start, end K) *CompactIter[K] {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	it := &CompactIter[K]{
+		tree: tree,
+		cur:  tree.bigger(tree.root, start, true),
+		end:  end,
+		span: true,
+	}
+	it.track()
+	return it
+}
+
+// Next travels the keys in the tree.
+func (it *CompactIter[K]) Next() bool {
+	if it.done {
+		return false
+	}
+	tree := it.tree
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	if it.gen != tree.gen {
+		// the nodes were released, which may have been reused
+		if it.gen < tree.cleared {
+			it.done = true
+			return false
+		}
+		it.cur = tree.bigger(tree.root, it.key, true)
+		if it.track(); it.done {
+			return false
+		}
+	}
+	last := it.cur
+	name := tree.nodes[last].name
+	it.name, it.data = name, tree.datas[last]
+	if it.cur = tree.bigger(tree.nodes[last].right, name, false); it.cur == 0 {
+		// go up until bigger value found
+		it.cur = tree.parent(last)
+		for it.cur != 0 && tree.isLess(tree.nodes[it.cur].name, name) {
+			it.cur = tree.parent(it.cur)
+		}
+	}
+	it.track()
+	return true
+}
+
+// track checks the cursor and keeps its key and the generation after the
+// cursor moved. The caller must hold the read lock.
+func (it *CompactIter[K]) track() {
+	tree := it.tree
+	if it.cur == 0 || (it.span && tree.isLess(it.end, tree.nodes[it.cur].name)) {
+		it.done = true
+		return
+	}
+	it.key, it.gen = tree.nodes[it.cur].name, tree.gen
+}
+
+// Key returns the key name.
+func (it *CompactIter[K]) Key() K {
+	return it.name
+}
+
+// Val returns the value data.
+func (it *CompactIter[K]) Val() interface{} {
+	return it.data
+}
+
+/*************************************************************************
+ * User data manipulation functions
+ ************************************************************************/
+
+// put inserts or replaces the key without recursion like Tree.put().
+func (tree *CompactTree[K]) put(name K, data interface{}) (interface{}, bool) {
+	var old interface{}
+	var found bool
+	var parent uint32
+	h := tree.root
+	depth, top := 0, math.MaxInt
+	c := 0
+	for h != 0 {
+		if LLRB234 {
+			// split 4-nodes on the way down
+			if tree.isRed(tree.nodes[h].left) && tree.isRed(tree.nodes[h].right) {
+				tree.flipColor(h)
+				if depth < top {
+					top = depth
+				}
+			}
+		}
+
+		if c = tree.compare(name, tree.nodes[h].name); c < 0 {
+			parent, h = h, tree.nodes[h].left
+		} else if c > 0 {
+			parent, h = h, tree.nodes[h].right
+		} else { // existing key found
+			old, found = tree.datas[h], true
+			tree.datas[h] = data
+			tree.stats.Put.Update++
+			break
+		}
+		depth++
+	}
+
+	if !found {
+		h = tree.alloc(name, data)
+		tree.setParent(h, parent)
+		if parent == 0 {
+			tree.root = h
+		} else if c < 0 {
+			tree.nodes[parent].left = h
+		} else {
+			tree.nodes[parent].right = h
+		}
+		tree.len++
+		tree.stats.Put.New++
+		if depth < top {
+			top = depth
+		}
+	}
+
+	// fix the path on the way up
+	for h != 0 && depth+2 >= top {
+		var changed bool
+		if h, changed = tree.balance(h); changed && depth < top {
+			top = depth
+		}
+		h = tree.parent(h)
+		depth--
+	}
+	addPerf(&tree.steps)
+	return old, found
+}
+
+// delete deletes the key without recursion like Tree.put() does.
+func (tree *CompactTree[K]) delete(name K) bool {
+	h := tree.root
+	if h == 0 {
+		return false
+	}
+
+	var match, leaf uint32
+	depth, top := 0, math.MaxInt
+	for {
+		c := tree.compare(name, tree.nodes[h].name)
+		if c < 0 {
+			// move red left
+			if l := tree.nodes[h].left; l != 0 && !tree.isRed(l) && !tree.isRed(tree.nodes[l].left) {
+				h = tree.moveRedLeft(h)
+				if depth < top {
+					top = depth
+				}
+			}
+			if tree.nodes[h].left == 0 {
+				break // not found
+			}
+			// keep going down to the left
+			h = tree.nodes[h].left
+		} else { // right or equal
+			if tree.isRed(tree.nodes[h].left) {
+				// the left child comes up, which is smaller than the key
+				h, c = tree.rotateRight(h), 1
+				if depth < top {
+					top = depth
+				}
+			}
+			// remove if equal at the bottom
+			if tree.nodes[h].right == 0 && c == 0 {
+				leaf = h
+				break
+			}
+			// move red right
+			if r := tree.nodes[h].right; r != 0 && !tree.isRed(r) && !tree.isRed(tree.nodes[r].left) {
+				if n := tree.moveRedRight(h); n != h {
+					h, c = n, 1
+				}
+				if depth < top {
+					top = depth
+				}
+			}
+			// found in the middle
+			if c == 0 {
+				match = h
+				break
+			}
+			if tree.nodes[h].right == 0 {
+				break // not found
+			}
+			// keep going down to the right
+			h = tree.nodes[h].right
+		}
+		depth++
+	}
+
+	if match != 0 {
+		// we delete the min node from the right instead
+		h = tree.nodes[match].right
+		depth++
+		for l := tree.nodes[h].left; l != 0; l = tree.nodes[h].left {
+			if !tree.isRed(l) && !tree.isRed(tree.nodes[l].left) {
+				h = tree.moveRedLeft(h)
+				if depth < top {
+					top = depth
+				}
+			}
+			h = tree.nodes[h].left
+			depth++
+		}
+		// 3-nodes are left-leaning, so this is a leaf.
+		// then copy the min node to the matched one
+		tree.nodes[match].name = tree.nodes[h].name
+		tree.datas[match] = tree.datas[h]
+		leaf = h
+	}
+
+	if leaf != 0 {
+		h = tree.parent(leaf)
+		tree.replace(leaf, 0)
+		tree.release(leaf)
+		tree.len--
+		if depth < top {
+			top = depth
+		}
+		depth--
+	}
+
+	// fix right-leaning red nodes on the way up
+	for h != 0 && depth+2 >= top {
+		var changed bool
+		if h, changed = tree.fixNode(h); changed && depth < top {
+			top = depth
+		}
+		h = tree.parent(h)
+		depth--
+	}
+	addPerf(&tree.steps)
+	return leaf != 0
+}
+
+func (tree *CompactTree[K]) get(name K) uint32 {
+	h := tree.root
+	for h != 0 {
+		if c := tree.compare(name, tree.nodes[h].name); c < 0 {
+			h = tree.nodes[h].left
+		} else if c > 0 {
+			h = tree.nodes[h].right
+		} else {
+			atomic.AddUint64(&tree.stats.Get.Found, 1)
+			return h
+		}
+	}
+	atomic.AddUint64(&tree.stats.Get.NotFound, 1)
+	return 0
+}
+
+func (tree *CompactTree[K]) bigger(h uint32, name K, equal bool) uint32 {
+	var found uint32
+	for h != 0 {
+		if c := tree.compare(name, tree.nodes[h].name); c < 0 {
+			found = h
+			h = tree.nodes[h].left
+		} else if c > 0 || !equal {
+			// continue to the right, also when the match is found
+			h = tree.nodes[h].right
+		} else {
+			return h
+		}
+	}
+	return found
+}
+
+func (tree *CompactTree[K]) smaller(h uint32, name K, equal bool) uint32 {
+	var found uint32
+	for h != 0 {
+		if c := tree.compare(name, tree.nodes[h].name); c > 0 {
+			found = h
+			h = tree.nodes[h].right
+		} else if c < 0 || !equal {
+			// continue to the left, also when the match is found
+			h = tree.nodes[h].left
+		} else {
+			return h
+		}
+	}
+	return found
+}
+
+func (tree *CompactTree[K]) entry(h uint32) (K, interface{}, bool) {
+	if h == 0 {
+		var n K
+		return n, nil, false
+	}
+	return tree.nodes[h].name, tree.datas[h], true
+}
+
+/*************************************************************************
+ * Tree property management functions
+ ************************************************************************/
+
+func (tree *CompactTree[K]) alloc(name K, data interface{}) uint32 {
+	h := tree.free
+	if h != 0 {
+		tree.free = tree.nodes[h].right
+	} else {
+		if uint32(len(tree.nodes)) == compactRed {
+			// the next index would overlap the color bit
+			panic("gomapllrb: CompactTree can't hold more than 2^31-1 keys")
+		}
+		h = uint32(len(tree.nodes))
+		tree.nodes = append(tree.nodes, compactNode[K]{})
+		tree.datas = append(tree.datas, nil)
+	}
+	tree.nodes[h] = compactNode[K]{name: name, up: compactRed}
+	tree.datas[h] = data
+	return h
+}
+
+func (tree *CompactTree[K]) release(h uint32) {
+	tree.nodes[h] = compactNode[K]{right: tree.free}
+	tree.datas[h] = nil
+	tree.free = h
+	tree.gen++
+}
+
+func (tree *CompactTree[K]) isRed(h uint32) bool {
+	return h != 0 && tree.nodes[h].up&compactRed != 0
+}
+
+func (tree *CompactTree[K]) setRed(h uint32, red bool) {
+	if h == 0 {
+		return
+	}
+	if red {
+		tree.nodes[h].up |= compactRed
+	} else {
+		tree.nodes[h].up &^= compactRed
+	}
+}
+
+func (tree *CompactTree[K]) parent(h uint32) uint32 {
+	return tree.nodes[h].up &^ compactRed
+}
+
+func (tree *CompactTree[K]) setParent(h, p uint32) {
+	if h == 0 {
+		return
+	}
+	tree.nodes[h].up = p | tree.nodes[h].up&compactRed
+}
+
+func (tree *CompactTree[K]) flipColor(h uint32) {
+	tree.nodes[h].up ^= compactRed
+	tree.nodes[tree.nodes[h].left].up ^= compactRed
+	tree.nodes[tree.nodes[h].right].up ^= compactRed
+	tree.steps.Flip++
+}
+
+// replace links the node h to the parent of the old node in place of it.
+func (tree *CompactTree[K]) replace(old, h uint32) {
+	p := tree.parent(old)
+	if p == 0 {
+		tree.root = h
+	} else if tree.nodes[p].left == old {
+		tree.nodes[p].left = h
+	} else {
+		tree.nodes[p].right = h
+	}
+	tree.setParent(h, p)
+}
+
+func (tree *CompactTree[K]) rotateLeft(h uint32) uint32 {
+	x := tree.nodes[h].right
+	tree.replace(h, x)
+	tree.setParent(h, x)
+	tree.nodes[h].right = tree.nodes[x].left
+	tree.setParent(tree.nodes[h].right, h)
+	tree.nodes[x].left = h
+	tree.setRed(x, tree.isRed(h))
+	tree.setRed(h, true)
+	tree.steps.Rotate.Left++
+	return x
+}
+
+func (tree *CompactTree[K]) rotateRight(h uint32) uint32 {
+	x := tree.nodes[h].left
+	tree.replace(h, x)
+	tree.setParent(h, x)
+	tree.nodes[h].left = tree.nodes[x].right
+	tree.setParent(tree.nodes[h].left, h)
+	tree.nodes[x].right = h
+	tree.setRed(x, tree.isRed(h))
+	tree.setRed(h, true)
+	tree.steps.Rotate.Right++
+	return x
+}
+
+func (tree *CompactTree[K]) moveRedLeft(h uint32) uint32 {
+	tree.flipColor(h)
+	if r := tree.nodes[h].right; tree.isRed(tree.nodes[r].left) {
+		tree.rotateRight(r)
+		h = tree.rotateLeft(h)
+		tree.flipColor(h)
+		if LLRB234 {
+			// 2-3-4 exclusive
+			if r = tree.nodes[h].right; tree.isRed(tree.nodes[r].right) {
+				tree.rotateLeft(r)
+			}
+		}
+	}
+	return h
+}
+
+func (tree *CompactTree[K]) moveRedRight(h uint32) uint32 {
+	tree.flipColor(h)
+	if l := tree.nodes[h].left; tree.isRed(tree.nodes[l].left) {
+		h = tree.rotateRight(h)
+		tree.flipColor(h)
+	}
+	return h
+}
+
+func (tree *CompactTree[K]) findMin(h uint32) uint32 {
+	for h != 0 && tree.nodes[h].left != 0 {
+		h = tree.nodes[h].left
+	}
+	return h
+}
+
+func (tree *CompactTree[K]) findMax(h uint32) uint32 {
+	for h != 0 && tree.nodes[h].right != 0 {
+		h = tree.nodes[h].right
+	}
+	return h
+}
+
+// balance fixes the node on the way up of put(). See Tree.balance().
+func (tree *CompactTree[K]) balance(h uint32) (uint32, bool) {
+	this, red := h, tree.isRed(h)
+
+	// fix right-leaning reds on the way up
+	if tree.isRed(tree.nodes[h].right) && !tree.isRed(tree.nodes[h].left) {
+		h = tree.rotateLeft(h)
+	}
+
+	// fix two reds in a row on the way up
+	if l := tree.nodes[h].left; tree.isRed(l) && tree.isRed(tree.nodes[l].left) {
+		h = tree.rotateRight(h)
+	}
+
+	if !LLRB234 {
+		// split 4-nodes on the way up
+		if tree.isRed(tree.nodes[h].left) && tree.isRed(tree.nodes[h].right) {
+			tree.flipColor(h)
+		}
+	}
+	return h, h != this || tree.isRed(h) != red
+}
+
+// fixNode fixes the node on the way up of delete(). See Tree.fixNode().
+func (tree *CompactTree[K]) fixNode(h uint32) (uint32, bool) {
+	this, red, left := h, tree.isRed(h), tree.nodes[h].left
+
+	// rotate right red to left
+	if r := tree.nodes[h].right; tree.isRed(r) {
+		if LLRB234 {
+			if tree.isRed(tree.nodes[r].left) {
+				tree.rotateRight(r)
+			}
+		}
+		h = tree.rotateLeft(h)
+	}
+	// rotate left red-red to right
+	if l := tree.nodes[h].left; tree.isRed(l) && tree.isRed(tree.nodes[l].left) {
+		h = tree.rotateRight(h)
+	}
+
+	if !LLRB234 {
+		// split 4-nodes
+		if tree.isRed(tree.nodes[h].left) && tree.isRed(tree.nodes[h].right) {
+			tree.flipColor(h)
+		}
+	}
+	return h, h != this || tree.isRed(h) != red || tree.nodes[h].left != left
+}
+
+/*************************************************************************
+ * Integrity checks and printing
+ ************************************************************************/
+
+// check verifies the red, black and LLRB properties in one pass without
+// recursion. The number of black nodes on the left-most path is compared
+// with all the other paths.
+func (tree *CompactTree[K]) check() error {
+	length := 0
+	for h := tree.root; h != 0; h = tree.nodes[h].left {
+		if !tree.isRed(h) {
+			length++
+		}
+	}
+
+	type pathObj struct {
+		h      uint32
+		blacks int
+	}
+	stack := append(make([]pathObj, 0, 64), pathObj{h: tree.root})
+	for len(stack) > 0 {
+		path := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if path.h == 0 {
+			if path.blacks != length {
+				return ErrBlackProperty
+			}
+			continue
+		}
+
+		l, r := tree.nodes[path.h].left, tree.nodes[path.h].right
+		if tree.isRed(path.h) && (tree.isRed(r) || tree.isRed(l)) {
+			return ErrRedProperty
+		}
+		if tree.isRed(r) && !tree.isRed(l) {
+			return ErrLLRBProperty
+		}
+		if !tree.isRed(path.h) {
+			path.blacks++
+		}
+		stack = append(stack,
+			pathObj{h: l, blacks: path.blacks},
+			pathObj{h: r, blacks: path.blacks})
+	}
+	return nil
+}
+
+// printNode prints the tree sideways like printNode() of Tree.
+func (tree *CompactTree[K]) printNode(out *bytes.Buffer) {
+	type lineObj struct {
+		h      uint32
+		prefix string // printed before the node
+		right  bool
+	}
+
+	// children returns the branches of the child nodes.
+	children := func(b lineObj) (lineObj, lineObj) {
+		var rstr, lstr string
+		if b.h != tree.root {
+			if b.right {
+				rstr, lstr = "    ", "│   "
+			} else {
+				rstr, lstr = "│   ", "    "
+			}
+		}
+		return lineObj{h: tree.nodes[b.h].right, prefix: b.prefix + rstr, right: true},
+			lineObj{h: tree.nodes[b.h].left, prefix: b.prefix + lstr, right: false}
+	}
+
+	var stack []lineObj
+	branch := lineObj{h: tree.root}
+	for branch.h != 0 || len(stack) > 0 {
+		for branch.h != 0 {
+			stack = append(stack, branch)
+			branch, _ = children(branch)
+		}
+		branch = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		h, red := branch.h, tree.isRed(branch.h)
+		out.WriteString(branch.prefix)
+		if h != tree.root {
+			if branch.right {
+				out.WriteString("┌──")
+			} else {
+				out.WriteString("└──")
+			}
+			if red {
+				out.WriteString("[")
+			} else {
+				out.WriteString("─")
+			}
+		} else if red {
+			// the root is red only in the middle of the changes
+			out.WriteString("[")
+		}
+		out.WriteString(fmt.Sprintf("%v", tree.nodes[h].name))
+		if red {
+			out.WriteString("]\n")
+		} else {
+			out.WriteString(" \n")
+		}
+		_, branch = children(branch)
+	}
+}
@@ -0,0 +1,149 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompact(t *testing.T) {
+	title("Test CompactTree")
+	assert := assert.New(t)
+
+	keys := []int{10, 20, 30, 40, 50, 60, 70, 80}
+	tree := NewCompact[int]()
+	assert.Equal(0, tree.Len())
+	_, _, e := tree.Min()
+	assert.False(e)
+	assert.False(tree.Iter().Next())
+
+	for _, k := range keys {
+		tree.Put(k, k)
+		assert.NoError(tree.Check())
+	}
+	assert.Equal(len(keys), tree.Len())
+	for _, k := range keys {
+		assert.Equal(k, tree.Get(k))
+		assert.True(tree.Exist(k))
+	}
+	assert.Nil(tree.Get(0))
+	tree.Put(10, 100)
+	assert.Equal(100, tree.Get(10))
+	assert.Equal(len(keys), tree.Len())
+
+	// getters
+	k, _, _ := tree.Min()
+	assert.Equal(10, k)
+	k, _, _ = tree.Max()
+	assert.Equal(80, k)
+	k, _, _ = tree.Bigger(40)
+	assert.Equal(50, k)
+	k, _, _ = tree.Smaller(40)
+	assert.Equal(30, k)
+	k, _, _ = tree.EqualOrBigger(45)
+	assert.Equal(50, k)
+	k, _, _ = tree.EqualOrSmaller(45)
+	assert.Equal(40, k)
+	_, _, e = tree.Bigger(80)
+	assert.False(e)
+	_, _, e = tree.Smaller(10)
+	assert.False(e)
+
+	// iterators
+	var got []int
+	for it := tree.Range(25, 65); it.Next(); {
+		got = append(got, it.Key())
+		assert.Equal(it.Key(), it.Val())
+	}
+	assert.Equal([]int{30, 40, 50, 60}, got)
+	assert.False(tree.Range(81, 90).Next())
+	assert.False(tree.Range(41, 49).Next())
+	assert.Equal(len(keys), len(tree.Map()))
+
+	// delete
+	for _, k := range keys {
+		assert.True(tree.Delete(k))
+		assert.NoError(tree.Check())
+	}
+	assert.False(tree.Delete(10))
+	assert.Equal(0, tree.Len())
+	tree.Put(1, 1)
+	tree.Clear()
+	assert.Equal(0, tree.Len())
+	assert.Equal(1, len(tree.nodes))
+
+	// an iterator stops after Clear()
+	for _, k := range keys {
+		tree.Put(k, k)
+	}
+	it := tree.Iter()
+	assert.True(it.Next())
+	tree.Clear()
+	tree.Put(1, 1)
+	assert.Equal(keys[0], it.Key())
+	assert.False(it.Next())
+	assert.False(it.Next())
+}
+
+func TestCompactIterDelete(t *testing.T) {
+	title("Test CompactTree iterators over deletes")
+	assert := assert.New(t)
+
+	tree := NewCompact[int]()
+	for i := 1; i <= 10; i++ {
+		tree.Put(i, i)
+	}
+	it := tree.Iter()
+	assert.True(it.Next())
+	tree.Delete(2)
+	tree.Delete(3)
+	tree.Put(100, 100) // takes a released node
+	assert.Equal(1, it.Key())
+	keys := []int{}
+	for it.Next() {
+		keys = append(keys, it.Key())
+		assert.Equal(it.Key(), it.Val())
+	}
+	assert.Equal([]int{4, 5, 6, 7, 8, 9, 10, 100}, keys)
+
+	// the key under the cursor deleted
+	it = tree.Range(5, 8)
+	assert.True(it.Next())
+	tree.Delete(6)
+	keys = []int{it.Key()}
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	assert.Equal([]int{5, 7, 8}, keys)
+}
+
+func TestCompactSameAsTree(t *testing.T) {
+	title("Test CompactTree forms the same structure as Tree")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	compact := NewCompact[int]()
+	for i := 0; i < 1000; i++ {
+		k := int(hash32(i) % 500)
+		if i%3 == 0 {
+			assert.Equal(tree.Delete(k), compact.Delete(k))
+		} else {
+			tree.Put(k, i)
+			compact.Put(k, i)
+		}
+	}
+	assert.NoError(compact.Check())
+	assert.Equal(tree.Len(), compact.Len())
+	assert.Equal(tree.String(), compact.String())
+	assert.Equal(tree.Map(), compact.Map())
+
+	// nodes are recycled
+	assert.Greater(len(compact.nodes), compact.Len())
+	num := compact.Len()
+	for i := 0; i < len(compact.nodes)-num-1; i++ {
+		compact.Put(1000+i, nil)
+	}
+	assert.Equal(compact.Len()+1, len(compact.nodes))
+}
@@ -0,0 +1,121 @@
+package gomapllrb
+
+// Conditional and read-modify-write operations.
+// Each of them runs under a single write lock, so the check and the
+// update can't be interleaved by other writers.
+//
+// Values are compared with the == operator in CompareAndSwap and
+// CompareAndDelete, which panics if the values are not comparable.
+
+// GetAndPut inserts or replaces the key and returns the previous value.
+// The boolean is true if the key existed.
+func (tree *Tree[K]) GetAndPut(name K, data interface{}) (interface{}, bool) {
+	defer tree.unlock(opPut, name, tree.lock())
+	return tree.putLocked(name, data)
+}
+
+// GetAndDelete deletes the key and returns the deleted value.
+// The boolean is true if the key existed.
+func (tree *Tree[K]) GetAndDelete(name K) (interface{}, bool) {
+	defer tree.unlock(opDelete, name, tree.lock())
+	return tree.deleteLocked(name)
+}
+
+// PutIfAbsent inserts the key only if it doesn't exist. If the key exists,
+// it returns the existing value and true without changing it.
+func (tree *Tree[K]) PutIfAbsent(name K, data interface{}) (interface{}, bool) {
+	defer tree.unlock(opPut, name, tree.lock())
+	if node := tree.find(tree.root, name); node != nil {
+		return node.data, true
+	}
+	tree.putLocked(name, data)
+	return nil, false
+}
+
+// GetOrPut returns the existing value of the key if present. Otherwise,
+// it stores the given value and returns it. The boolean is true if the
+// value was loaded, false if stored.
+func (tree *Tree[K]) GetOrPut(name K, data interface{}) (interface{}, bool) {
+	defer tree.unlock(opPut, name, tree.lock())
+	if node := tree.find(tree.root, name); node != nil {
+		return node.data, true
+	}
+	tree.putLocked(name, data)
+	return data, false
+}
+
+// Replace replaces the value only if the key exists.
+// It returns the previous value and true if replaced.
+func (tree *Tree[K]) Replace(name K, data interface{}) (interface{}, bool) {
+	defer tree.unlock(opPut, name, tree.lock())
+	if node := tree.find(tree.root, name); node == nil {
+		return nil, false
+	}
+	return tree.putLocked(name, data)
+}
+
+// CompareAndSwap replaces the value only if the key exists and its value
+// is equal to old. It returns true if swapped.
+func (tree *Tree[K]) CompareAndSwap(name K, old, new interface{}) bool {
+	defer tree.unlock(opPut, name, tree.lock())
+	if node := tree.find(tree.root, name); node == nil || node.data != old {
+		return false
+	}
+	tree.putLocked(name, new)
+	return true
+}
+
+// CompareAndDelete deletes the key only if its value is equal to old.
+// It returns true if deleted.
+func (tree *Tree[K]) CompareAndDelete(name K, old interface{}) bool {
+	defer tree.unlock(opDelete, name, tree.lock())
+	if node := tree.find(tree.root, name); node == nil || node.data != old {
+		return false
+	}
+	tree.deleteLocked(name)
+	return true
+}
+
+// Compute calls fn with the current value of the key and stores the value
+// fn returns. The found argument tells whether the key exists. If fn returns
+// false as keep, the key is deleted instead. It returns the new value and
+// whether the key exists after the operation.
+//
+//	tree.Compute("counter", func(old interface{}, found bool) (interface{}, bool) {
+//	  if !found {
+//	    return 1, true
+//	  }
+//	  return old.(int) + 1, true
+//	})
+//
+// fn is called under the write lock, so it must not access the tree.
+func (tree *Tree[K]) Compute(name K, fn func(old interface{}, found bool) (data interface{}, keep bool)) (interface{}, bool) {
+	defer tree.unlock(opPut, name, tree.lock())
+	var old interface{}
+	node := tree.find(tree.root, name)
+	if node != nil {
+		old = node.data
+	}
+	data, keep := fn(old, node != nil)
+	if !keep {
+		if node != nil {
+			tree.deleteLocked(name)
+		}
+		return nil, false
+	}
+	tree.putLocked(name, data)
+	return data, true
+}
+
+// Update calls fn with the current value and replaces it with the value
+// fn returns. It does nothing and returns false if the key is not found.
+// fn is called under the write lock, so it must not access the tree.
+func (tree *Tree[K]) Update(name K, fn func(old interface{}) interface{}) bool {
+	defer tree.unlock(opPut, name, tree.lock())
+	node := tree.find(tree.root, name)
+	if node == nil {
+		return false
+	}
+	tree.putLocked(name, fn(node.data))
+	return true
+}
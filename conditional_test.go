@@ -0,0 +1,115 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditional(t *testing.T) {
+	title("Test conditional operations")
+	assert := assert.New(t)
+	tree := New[string]()
+
+	// GetAndPut & GetAndDelete
+	old, found := tree.GetAndPut("a", 1)
+	assert.Nil(old)
+	assert.False(found)
+	old, found = tree.GetAndPut("a", 2)
+	assert.Equal(1, old)
+	assert.True(found)
+	old, found = tree.GetAndDelete("a")
+	assert.Equal(2, old)
+	assert.True(found)
+	old, found = tree.GetAndDelete("a")
+	assert.Nil(old)
+	assert.False(found)
+
+	// PutIfAbsent
+	old, found = tree.PutIfAbsent("a", 1)
+	assert.Nil(old)
+	assert.False(found)
+	old, found = tree.PutIfAbsent("a", 2)
+	assert.Equal(1, old)
+	assert.True(found)
+	assert.Equal(1, tree.Get("a"))
+
+	// GetOrPut
+	v, loaded := tree.GetOrPut("b", 10)
+	assert.Equal(10, v)
+	assert.False(loaded)
+	v, loaded = tree.GetOrPut("b", 20)
+	assert.Equal(10, v)
+	assert.True(loaded)
+
+	// Replace
+	_, found = tree.Replace("c", 1)
+	assert.False(found)
+	assert.False(tree.Exist("c"))
+	old, found = tree.Replace("b", 11)
+	assert.Equal(10, old)
+	assert.True(found)
+	assert.Equal(11, tree.Get("b"))
+
+	// CompareAndSwap & CompareAndDelete
+	assert.False(tree.CompareAndSwap("b", 10, 12))
+	assert.True(tree.CompareAndSwap("b", 11, 12))
+	assert.False(tree.CompareAndSwap("c", nil, 1))
+	assert.Equal(12, tree.Get("b"))
+	assert.False(tree.CompareAndDelete("b", 11))
+	assert.True(tree.CompareAndDelete("b", 12))
+	assert.False(tree.Exist("b"))
+
+	// Update
+	assert.False(tree.Update("c", func(old interface{}) interface{} { return 1 }))
+	assert.False(tree.Exist("c"))
+	assert.True(tree.Update("a", func(old interface{}) interface{} { return old.(int) + 1 }))
+	assert.Equal(2, tree.Get("a"))
+
+	// Compute
+	v, found = tree.Compute("c", func(old interface{}, found bool) (interface{}, bool) {
+		assert.False(found)
+		return 100, true
+	})
+	assert.Equal(100, v)
+	assert.True(found)
+	v, found = tree.Compute("c", func(old interface{}, found bool) (interface{}, bool) {
+		assert.True(found)
+		assert.Equal(100, old)
+		return nil, false
+	})
+	assert.Nil(v)
+	assert.False(found)
+	assert.False(tree.Exist("c"))
+	assert.Equal(1, tree.Len())
+	assertTreeCheck(t, tree, false)
+}
+
+func TestComputeConcurrency(t *testing.T) {
+	title("Test Compute() concurrency")
+	assert := assert.New(t)
+	tree := New[int]()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				tree.Compute(i%10, func(old interface{}, found bool) (interface{}, bool) {
+					if !found {
+						return 1, true
+					}
+					return old.(int) + 1, true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		assert.Equal(800, tree.Get(i))
+	}
+}
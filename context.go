@@ -0,0 +1,174 @@
+package gomapllrb
+
+import (
+	"context"
+	"time"
+)
+
+// IterContext returns an iterator which stops when the context is cancelled.
+// Check Err() after the iteration to tell the cancellation from the end.
+func (tree *Tree[K]) IterContext(ctx context.Context) *Iter[K] {
+	it := tree.Iter()
+	it.ctx = ctx
+	return it
+}
+
+// WalkContext calls fn for each key in order while holding the read lock,
+// so it sees a consistent view of the tree. It stops when fn returns false
+// or the context is cancelled, in which case the context error is returned.
+func (tree *Tree[K]) WalkContext(ctx context.Context, fn func(name K, data interface{}) bool) error {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	it := &Iter[K]{
+		tree: tree,
+		cur:  findMin(tree.root),
+	}
+	if it.cur == nil {
+		return nil
+	}
+	poll := ctxPoller{ctx: ctx}
+	for it.next() {
+		if err := poll.err(); err != nil {
+			return err
+		}
+		if tree.isExpired(it.last.name) {
+			continue
+		}
+		if !fn(it.last.name, it.last.data) {
+			break
+		}
+	}
+	return nil
+}
+
+// CheckContext is same as Check() but stops when the context is cancelled
+// and returns the context error.
+func (tree *Tree[K]) CheckContext(ctx context.Context) error {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	err := tree.check(ctx)
+	if err != nil {
+		tree.logCheck(ctx, err)
+	}
+	return err
+}
+
+// check verifies the tree. The caller must hold the read lock.
+func (tree *Tree[K]) check(ctx context.Context) error {
+	if err := checkRoot(tree.root); err != nil {
+		return err
+	}
+	if err := checkRed(ctx, tree.root); err != nil {
+		return err
+	}
+	if err := checkBlack(ctx, tree.root); err != nil {
+		return err
+	}
+	if err := checkLLRB(ctx, tree.root); err != nil {
+		return err
+	}
+	shape, err := shapeOf(ctx, tree.root)
+	if err != nil {
+		return err
+	}
+	return checkHeight(shape)
+}
+
+// TryPut is same as Put() but it returns false immediately without
+// storing the key if the lock is held by others.
+func (tree *Tree[K]) TryPut(name K, data interface{}) bool {
+	start, ok := tree.tryLock()
+	if !ok {
+		return false
+	}
+	defer tree.unlock(opPut, name, start)
+	tree.putLocked(name, data)
+	return true
+}
+
+// TryDelete is same as Delete() but it returns false as ok immediately
+// without deleting the key if the lock is held by others.
+func (tree *Tree[K]) TryDelete(name K) (deleted bool, ok bool) {
+	start, ok := tree.tryLock()
+	if !ok {
+		return false, false
+	}
+	defer tree.unlock(opDelete, name, start)
+	_, deleted = tree.deleteLocked(name)
+	return deleted, true
+}
+
+// PutContext is same as Put() but gives up waiting for the lock when the
+// context is cancelled or its deadline is exceeded.
+func (tree *Tree[K]) PutContext(ctx context.Context, name K, data interface{}) error {
+	start, err := tree.lockContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer tree.unlock(opPut, name, start)
+	tree.putLocked(name, data)
+	return nil
+}
+
+// DeleteContext is same as Delete() but gives up waiting for the lock when
+// the context is cancelled or its deadline is exceeded.
+func (tree *Tree[K]) DeleteContext(ctx context.Context, name K) (bool, error) {
+	start, err := tree.lockContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tree.unlock(opDelete, name, start)
+	_, deleted := tree.deleteLocked(name)
+	return deleted, nil
+}
+
+// lockContext is same as lock() but gives up unless the write lock is
+// acquired before the context is done. It waits in the queue of the lock
+// like Lock() does, so it's not starved by the readers. The lock acquired
+// after giving up is handed back.
+func (tree *Tree[K]) lockContext(ctx context.Context) (time.Time, error) {
+	if ctx.Done() == nil {
+		return tree.lock(), nil
+	}
+	start, ok := tree.tryLock()
+	if ok {
+		return start, nil
+	}
+	locked := make(chan struct{})
+	go func() {
+		tree.mutex.Lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		tree.locked(start, true)
+		return start, nil
+	case <-ctx.Done():
+		// The goroutine left behind takes the lock in its turn and
+		// releases it right away without touching the tree. It only
+		// delays the writers queued after it by one handoff, and it
+		// exits once the lock has been free.
+		go func() {
+			<-locked
+			tree.mutex.Unlock()
+		}()
+		return start, ctx.Err()
+	}
+}
+
+// ctxPollEvery is the number of the nodes visited between the context
+// checks, since ctx.Err() takes a lock.
+const ctxPollEvery = 1024
+
+// ctxPoller checks the context on the first and every ctxPollEvery nodes.
+type ctxPoller struct {
+	ctx context.Context
+	n   int
+}
+
+func (p *ctxPoller) err() error {
+	if p.n++; p.n%ctxPollEvery != 1 {
+		return nil
+	}
+	return p.ctx.Err()
+}
@@ -0,0 +1,119 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	title("Test context-aware operations")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	for i := 0; i < 100; i++ {
+		tree.Put(i, i)
+	}
+
+	// IterContext
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	num := 0
+	it := tree.IterContext(ctx)
+	for it.Next() {
+		if num++; num == 10 {
+			cancel()
+		}
+	}
+	assert.Equal(10, num)
+	assert.ErrorIs(it.Err(), context.Canceled)
+	assert.False(it.Next())
+
+	it = tree.IterContext(context.Background())
+	for num = 0; it.Next(); num++ {
+	}
+	assert.Equal(100, num)
+	assert.NoError(it.Err())
+
+	// WalkContext
+	num = 0
+	assert.NoError(tree.WalkContext(context.Background(), func(name int, data interface{}) bool {
+		assert.Equal(num, name)
+		num++
+		return num < 50
+	}))
+	assert.Equal(50, num)
+	assert.ErrorIs(tree.WalkContext(ctx, func(name int, data interface{}) bool {
+		return true
+	}), context.Canceled)
+
+	// CheckContext
+	assert.NoError(tree.CheckContext(context.Background()))
+	assert.ErrorIs(tree.CheckContext(ctx), context.Canceled)
+}
+
+func TestLockContext(t *testing.T) {
+	title("Test lock acquisition with context")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	assert.True(tree.TryPut(1, 1))
+	deleted, ok := tree.TryDelete(1)
+	assert.True(deleted)
+	assert.True(ok)
+
+	// while the lock is held by others
+	tree.mutex.RLock()
+	assert.False(tree.TryPut(1, 1))
+	_, ok = tree.TryDelete(1)
+	assert.False(ok)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(tree.PutContext(ctx, 1, 1), context.DeadlineExceeded)
+	_, err := tree.DeleteContext(ctx, 1)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	tree.mutex.RUnlock()
+	assert.False(tree.Exist(1))
+
+	// acquired when the lock is released
+	tree.mutex.Lock()
+	go func() {
+		time.Sleep(time.Millisecond)
+		tree.mutex.Unlock()
+	}()
+	assert.NoError(tree.PutContext(context.Background(), 1, 1))
+	deleted, err = tree.DeleteContext(context.Background(), 1)
+	assert.True(deleted)
+	assert.NoError(err)
+
+	// not starved by the overlapping readers
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				tree.mutex.RLock()
+				time.Sleep(time.Millisecond)
+				tree.mutex.RUnlock()
+			}
+		}()
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(tree.PutContext(ctx, 2, 2))
+	close(stop)
+	wg.Wait()
+	assert.True(tree.Exist(2))
+}
@@ -0,0 +1,219 @@
+package gomapllrb
+
+import (
+	"container/list"
+	"sync"
+
+	"golang.org/x/exp/constraints"
+)
+
+// EvictPolicy decides which key is evicted when the tree is full.
+type EvictPolicy int
+
+const (
+	// EvictMin evicts the smallest key. (default)
+	EvictMin EvictPolicy = iota
+	// EvictMax evicts the largest key.
+	EvictMax
+	// EvictLRU evicts the least recently used key.
+	EvictLRU
+	// EvictLFU evicts the least frequently used key.
+	// Ties are broken by evicting the least recently used one.
+	EvictLFU
+)
+
+// WithMaxLen limits the number of objects stored. When a new key makes the
+// tree exceed the limit, a key is evicted according to the eviction policy.
+// Note that the new key itself can be evicted by EvictMin or EvictMax.
+func WithMaxLen(n int) Option {
+	return func(o *options) {
+		o.maxLen = n
+	}
+}
+
+// WithEvictPolicy sets the eviction policy used with WithMaxLen().
+func WithEvictPolicy(policy EvictPolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+// OnEvict sets a callback function called when a key is evicted.
+// The callback is called under the write lock, so it must not access the tree.
+func (tree *Tree[K]) OnEvict(fn func(name K, data interface{})) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	if tree.evict != nil {
+		tree.evict.onEvict = fn
+	}
+}
+
+// evictLocked tracks the put and evicts keys if the tree is full.
+// The caller must hold the write lock.
+func (tree *Tree[K]) evictLocked(name K, found bool) {
+	if found {
+		tree.evict.touch(name)
+		return
+	}
+	// the new key is not tracked yet, so LRU and LFU never evict it
+	for tree.len > tree.maxLen {
+		victim, ok := tree.evict.victim(tree.root)
+		if !ok {
+			break
+		}
+		data, found := tree.remove(victim)
+		if !found {
+			// a key tracked but not stored is a bug, drop it not to spin
+			if !tree.evict.tracking() {
+				break
+			}
+			tree.evict.remove(victim)
+			continue
+		}
+		tree.stats.Evicted++
+		if tree.evict.onEvict != nil {
+			tree.evict.onEvict(victim, data)
+		}
+	}
+	tree.evict.add(name)
+}
+
+/*************************************************************************
+ * Usage tracking
+ ************************************************************************/
+
+// evictor tracks the key usage for LRU and LFU policies. The keys are kept
+// in the lists by the frequency of use. LRU uses a single list. The least
+// recently used key is at the back of each list. The keys are the ones
+// kept in the nodes, since the map takes the keys equal by a custom
+// comparator as different.
+type evictor[K constraints.Ordered] struct {
+	policy  EvictPolicy
+	onEvict func(name K, data interface{})
+
+	items   map[K]*list.Element
+	lists   map[uint64]*list.List // lists by frequency
+	minFreq uint64
+	mutex   sync.Mutex // reads update the usage under the tree's read lock
+}
+
+type evictEntry[K constraints.Ordered] struct {
+	name K
+	freq uint64
+}
+
+func newEvictor[K constraints.Ordered](policy EvictPolicy) *evictor[K] {
+	e := &evictor[K]{
+		policy: policy,
+	}
+	e.reset()
+	return e
+}
+
+func (e *evictor[K]) tracking() bool {
+	return e.policy == EvictLRU || e.policy == EvictLFU
+}
+
+func (e *evictor[K]) add(name K) {
+	if !e.tracking() {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.items[name] = e.list(1).PushFront(evictEntry[K]{name: name, freq: 1})
+	e.minFreq = 1
+}
+
+func (e *evictor[K]) touch(name K) {
+	if !e.tracking() {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	elem, ok := e.items[name]
+	if !ok {
+		return
+	}
+	if e.policy == EvictLRU {
+		e.lists[1].MoveToFront(elem)
+		return
+	}
+	entry := e.unlink(elem)
+	if entry.freq == e.minFreq && e.lists[entry.freq] == nil {
+		e.minFreq++
+	}
+	entry.freq++
+	e.items[name] = e.list(entry.freq).PushFront(entry)
+}
+
+func (e *evictor[K]) remove(name K) {
+	if !e.tracking() {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if elem, ok := e.items[name]; ok {
+		e.unlink(elem)
+		delete(e.items, name)
+	}
+}
+
+// victim returns the key to evict.
+func (e *evictor[K]) victim(root *Node[K]) (K, bool) {
+	var node *Node[K]
+	switch e.policy {
+	case EvictMax:
+		node = findMax(root)
+	case EvictLRU, EvictLFU:
+		e.mutex.Lock()
+		defer e.mutex.Unlock()
+		if len(e.items) == 0 {
+			var n K
+			return n, false
+		}
+		if e.lists[e.minFreq] == nil {
+			// the min list has gone by removals, find the new one
+			e.minFreq = 0
+			for freq := range e.lists {
+				if e.minFreq == 0 || freq < e.minFreq {
+					e.minFreq = freq
+				}
+			}
+		}
+		return e.lists[e.minFreq].Back().Value.(evictEntry[K]).name, true
+	default:
+		node = findMin(root)
+	}
+	if node == nil {
+		var n K
+		return n, false
+	}
+	return node.name, true
+}
+
+func (e *evictor[K]) reset() {
+	e.items = make(map[K]*list.Element)
+	e.lists = make(map[uint64]*list.List)
+	e.minFreq = 0
+}
+
+// list returns the list of the frequency, creating it if needed.
+func (e *evictor[K]) list(freq uint64) *list.List {
+	l, ok := e.lists[freq]
+	if !ok {
+		l = list.New()
+		e.lists[freq] = l
+	}
+	return l
+}
+
+// unlink removes the element from its list and drops the list if empty.
+func (e *evictor[K]) unlink(elem *list.Element) evictEntry[K] {
+	entry := elem.Value.(evictEntry[K])
+	l := e.lists[entry.freq]
+	l.Remove(elem)
+	if l.Len() == 0 {
+		delete(e.lists, entry.freq)
+	}
+	return entry
+}
@@ -0,0 +1,125 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"cmp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvictMinMax(t *testing.T) {
+	title("Test eviction / min & max")
+	assert := assert.New(t)
+
+	// keep the newest 3 keys
+	tree := New[int](WithMaxLen(3))
+	var evicted []int
+	tree.OnEvict(func(name int, data interface{}) {
+		assert.Equal(name, data)
+		evicted = append(evicted, name)
+	})
+	for i := 1; i <= 5; i++ {
+		tree.Put(i, i)
+	}
+	tree.Put(5, 5) // update doesn't evict
+	assert.Equal(3, tree.Len())
+	assert.Equal([]int{1, 2}, evicted)
+	assert.Equal(map[int]interface{}{3: 3, 4: 4, 5: 5}, tree.Map())
+	assert.Equal(uint64(2), tree.Stats().Evicted)
+	assertTreeCheck(t, tree, false)
+
+	// keep the smallest 3 keys
+	tree = New[int](WithMaxLen(3), WithEvictPolicy(EvictMax))
+	for _, k := range []int{5, 1, 4, 2, 3} {
+		tree.Put(k, k)
+	}
+	assert.Equal(map[int]interface{}{1: 1, 2: 2, 3: 3}, tree.Map())
+}
+
+func TestEvictLRU(t *testing.T) {
+	title("Test eviction / LRU")
+	assert := assert.New(t)
+
+	tree := New[string](WithMaxLen(3), WithEvictPolicy(EvictLRU))
+	tree.Put("a", 1)
+	tree.Put("b", 2)
+	tree.Put("c", 3)
+	tree.Get("a")
+	tree.Put("d", 4) // evicts b
+	assert.False(tree.Exist("b"))
+	tree.Put("c", 30)
+	tree.Put("e", 5) // evicts a
+	assert.False(tree.Exist("a"))
+	assert.Equal(map[string]interface{}{"c": 30, "d": 4, "e": 5}, tree.Map())
+
+	// deleted keys are no longer tracked
+	tree.Delete("d")
+	tree.Put("f", 6)
+	tree.Put("g", 7) // evicts c
+	assert.Equal(map[string]interface{}{"e": 5, "f": 6, "g": 7}, tree.Map())
+
+	tree.Clear()
+	tree.Put("h", 8)
+	assert.Equal(1, tree.Len())
+	assertTreeCheck(t, tree, false)
+
+	// the keys equal by the comparator
+	tree = New[string](WithMaxLen(2), WithEvictPolicy(EvictLRU))
+	tree.SetCompare(func(a, b string) int { return cmp.Compare(strings.ToLower(a), strings.ToLower(b)) })
+	tree.Put("a", 1)
+	tree.Put("b", 2)
+	tree.Put("A", 10)
+	tree.Put("c", 3) // evicts b
+	assert.Equal(map[string]interface{}{"a": 10, "c": 3}, tree.Map())
+	tree.Delete("C")
+	tree.Put("d", 4)
+	tree.Put("e", 5) // evicts a
+	assert.Equal(map[string]interface{}{"d": 4, "e": 5}, tree.Map())
+	assert.Equal(2, len(tree.evict.items))
+}
+
+func TestEvictUntracked(t *testing.T) {
+	title("Test eviction / a tracked key not stored")
+	assert := assert.New(t)
+
+	tree := New[int](WithMaxLen(2), WithEvictPolicy(EvictLRU))
+	tree.evict.add(100) // the least recently used, but not stored
+	tree.Put(1, 1)
+	tree.Put(2, 2)
+	tree.Put(3, 3) // skips 100 and evicts 1
+	assert.Equal(map[int]interface{}{2: 2, 3: 3}, tree.Map())
+	assert.Equal(uint64(1), tree.Stats().Evicted)
+	assert.Equal(2, len(tree.evict.items))
+}
+
+func TestEvictLFU(t *testing.T) {
+	title("Test eviction / LFU")
+	assert := assert.New(t)
+
+	tree := New[string](WithMaxLen(3), WithEvictPolicy(EvictLFU))
+	tree.Put("a", 1)
+	tree.Put("b", 2)
+	tree.Put("c", 3)
+	tree.Get("a")
+	tree.Get("a")
+	tree.Get("b")
+	tree.Put("d", 4) // evicts c
+	assert.Equal(map[string]interface{}{"a": 1, "b": 2, "d": 4}, tree.Map())
+	tree.Get("d")
+	tree.Put("e", 5) // b and d are tied, evicts b used earlier
+	assert.Equal(map[string]interface{}{"a": 1, "d": 4, "e": 5}, tree.Map())
+
+	// removing the least frequent key moves the min frequency up
+	tree.Delete("e")
+	tree.Get("d")
+	tree.Get("d")
+	tree.Put("f", 6)
+	tree.Delete("f")
+	tree.Put("g", 7)
+	tree.Put("h", 8) // evicts g
+	assert.Equal(map[string]interface{}{"a": 1, "d": 4, "h": 8}, tree.Map())
+	assertTreeCheck(t, tree, false)
+}
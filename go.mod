@@ -1,6 +1,6 @@
 module github.com/wolkykim/gomapllrb
 
-go 1.20
+go 1.21
 
 require (
 	github.com/spaolacci/murmur3 v1.1.0
@@ -8,8 +8,12 @@ package gomapllrb
 
 import (
 	"bytes"
+	"cmp"
+	"context"
 	"fmt"
+	"math"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/exp/constraints"
 )
@@ -21,13 +25,26 @@ const (
 
 // Tree is the glorious tree struct.
 type Tree[K constraints.Ordered] struct {
-	isLess Comparator[K] // data comparator (default: string comparator)
+	isLess  Comparator[K]  // data comparator (default: string comparator)
+	compare CompareFunc[K] // three-way comparator (default: cmp.Compare)
 
 	root  *Node[K]     // root node
 	len   int          // number of object stored
 	mutex sync.RWMutex // reader/writer mutual exclusion lock
 
-	stats Stats // usage and performance metrics
+	stats   Stats                   // usage and performance metrics
+	ttl     *ttlIndex[K]            // expiration index, created on first use
+	maxLen  int                     // max number of objects, 0 for unlimited
+	evict   *evictor[K]             // eviction policy, set if maxLen is set
+	notify  *notifier[K]            // change notifications, created on first use
+	pool    *nodePool[K]            // node allocator, set if arena is enabled
+	mem     memUsage[K]             // memory usage accounting
+	trace   *tracer[K]              // step tracer, set by SetTracer()
+	metrics *metrics                // per-operation metrics, set if enabled
+	log     atomic.Pointer[treeLog] // logger, set by SetLogger()
+	oplog   *OpRecorder[K]          // operation log, set by SetRecorder()
+	ckpt    *checkpoint[K]          // checkpoint tracking, set by Checkpoint()
+	steps   PerfStats               // rotations and flips of the write in progress
 }
 
 // Node is like an apple on the apple trees.
@@ -35,10 +52,12 @@ type Node[K constraints.Ordered] struct {
 	name K
 	data interface{}
 
-	red   bool
-	up    *Node[K]
-	left  *Node[K]
-	right *Node[K]
+	red      bool
+	dirty    bool // put since the last checkpoint
+	dirtySub bool // dirty or has a dirty node below, set by Checkpoint()
+	up       *Node[K]
+	left     *Node[K]
+	right    *Node[K]
 }
 
 // Stats provides usage statistics accessible via Stats() method.
@@ -58,7 +77,16 @@ type Stats struct {
 		Found    uint64
 		NotFound uint64
 	}
+	Expired uint64
+	Evicted uint64
+	Memory  struct {
+		Sum    uint64
+		Nodes  uint64
+		Keys   uint64
+		Values uint64
+	}
 	Perf PerfStats
+	Ops  OpStats // set if enabled by WithMetrics()
 }
 
 // PerfStats are global stats for debugging purpose.
@@ -71,11 +99,39 @@ type PerfStats struct {
 	}
 }
 
+// Option configures a tree in New().
+type Option func(*options)
+
+type options struct {
+	maxLen  int
+	policy  EvictPolicy
+	arena   int
+	metrics bool
+}
+
 // New creates a new tree.
-func New[K constraints.Ordered]() *Tree[K] {
-	return &Tree[K]{
-		isLess: IsLess[K],
+//
+//	tree := New[int](WithMaxLen(1000000), WithEvictPolicy(EvictLRU))
+func New[K constraints.Ordered](opts ...Option) *Tree[K] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
 	}
+	tree := &Tree[K]{
+		isLess:  IsLess[K],
+		compare: cmp.Compare[K],
+	}
+	if o.maxLen > 0 {
+		tree.maxLen = o.maxLen
+		tree.evict = newEvictor[K](o.policy)
+	}
+	if o.arena > 0 {
+		tree.pool = newNodePool[K](o.arena)
+	}
+	if o.metrics {
+		tree.metrics = &metrics{}
+	}
+	return tree
 }
 
 // SetLess sets a user comparator function.
@@ -85,33 +141,38 @@ func New[K constraints.Ordered]() *Tree[K] {
 //	}
 func (tree *Tree[K]) SetLess(fn Comparator[K]) {
 	tree.isLess = fn
+	tree.compare = lessToCompare(fn)
+}
+
+// SetCompare sets a user three-way comparator function. It takes one
+// comparison per level of the tree where SetLess() takes two, so it's
+// preferred for expensive comparators.
+//
+//	func myCompare[K constraints.Ordered](a, b K) int {
+//	  // return a negative number if a < b, zero if a == b, or a positive number
+//	}
+func (tree *Tree[K]) SetCompare(fn CompareFunc[K]) {
+	tree.compare = fn
+	tree.isLess = compareToLess(fn)
 }
 
 // Put inserts a new key or replaces old if the same key is found.
 func (tree *Tree[K]) Put(name K, data interface{}) {
-	tree.mutex.Lock()
-	defer tree.mutex.Unlock()
-	tree.root = tree.put(tree.root, name, data)
-	tree.root.red = false
+	defer tree.unlock(opPut, name, tree.lock())
+	tree.putLocked(name, data)
 }
 
 // Delete deletes the key. It returns an error if the key is not found.
 func (tree *Tree[K]) Delete(name K) bool {
-	tree.mutex.Lock()
-	defer tree.mutex.Unlock()
-	var deleted bool
-	tree.root, deleted = tree.delete(tree.root, name)
-	if tree.root != nil {
-		tree.root.red = false
-	}
+	defer tree.unlock(opDelete, name, tree.lock())
+	_, deleted := tree.deleteLocked(name)
 	return deleted
 }
 
 // Get returns the value of the key. If key is not found, it returns Nil.
 // When Nil value is expected as a actual value, use Exist() instead.
 func (tree *Tree[K]) Get(name K) interface{} {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
+	defer tree.runlockKey(opGet, name, tree.rlock())
 	if node := tree.get(tree.root, name); node != nil {
 		return node.data
 	}
@@ -120,8 +181,7 @@ func (tree *Tree[K]) Get(name K) interface{} {
 
 // Exist checks if the key exists.
 func (tree *Tree[K]) Exist(name K) bool {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
+	defer tree.runlockKey(opGet, name, tree.rlock())
 	if node := tree.get(tree.root, name); node != nil {
 		return true
 	}
@@ -130,9 +190,8 @@ func (tree *Tree[K]) Exist(name K) bool {
 
 // Min returns a min key and value.
 func (tree *Tree[K]) Min() (K, interface{}, bool) {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
-	if node := findMin(tree.root); node != nil {
+	defer tree.runlock(opMin, tree.rlock())
+	if node := tree.skipBigger(findMin(tree.root)); node != nil {
 		return node.name, node.data, true
 	}
 	var n K
@@ -141,9 +200,8 @@ func (tree *Tree[K]) Min() (K, interface{}, bool) {
 
 // Max returns a max key and value.
 func (tree *Tree[K]) Max() (K, interface{}, bool) {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
-	if node := findMax(tree.root); node != nil {
+	defer tree.runlock(opMax, tree.rlock())
+	if node := tree.skipSmaller(findMax(tree.root)); node != nil {
 		return node.name, node.data, true
 	}
 	var n K
@@ -152,9 +210,8 @@ func (tree *Tree[K]) Max() (K, interface{}, bool) {
 
 // Bigger finds the next key bigger than given ken.
 func (tree *Tree[K]) Bigger(name K) (K, interface{}, bool) {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
-	if node := tree.bigger(tree.root, name, false); node != nil {
+	defer tree.runlockKey(opBigger, name, tree.rlock())
+	if node := tree.skipBigger(tree.bigger(tree.root, name, false)); node != nil {
 		return node.name, node.data, true
 	}
 	var n K
@@ -163,9 +220,8 @@ func (tree *Tree[K]) Bigger(name K) (K, interface{}, bool) {
 
 // Smaller finds the next key bigger than given ken.
 func (tree *Tree[K]) Smaller(name K) (K, interface{}, bool) {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
-	if node := tree.smaller(tree.root, name, false); node != nil {
+	defer tree.runlockKey(opSmaller, name, tree.rlock())
+	if node := tree.skipSmaller(tree.smaller(tree.root, name, false)); node != nil {
 		return node.name, node.data, true
 	}
 	var n K
@@ -174,9 +230,8 @@ func (tree *Tree[K]) Smaller(name K) (K, interface{}, bool) {
 
 // EqualOrBigger finds a matching key or the next bigger key.
 func (tree *Tree[K]) EqualOrBigger(name K) (K, interface{}, bool) {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
-	if node := tree.bigger(tree.root, name, true); node != nil {
+	defer tree.runlockKey(opBigger, name, tree.rlock())
+	if node := tree.skipBigger(tree.bigger(tree.root, name, true)); node != nil {
 		return node.name, node.data, true
 	}
 	var n K
@@ -185,9 +240,8 @@ func (tree *Tree[K]) EqualOrBigger(name K) (K, interface{}, bool) {
 
 // EqualOrSmaller finds a matching key or the next smaller key.
 func (tree *Tree[K]) EqualOrSmaller(name K) (K, interface{}, bool) {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
-	if node := tree.smaller(tree.root, name, true); node != nil {
+	defer tree.runlockKey(opSmaller, name, tree.rlock())
+	if node := tree.skipSmaller(tree.smaller(tree.root, name, true)); node != nil {
 		return node.name, node.data, true
 	}
 	var n K
@@ -195,32 +249,65 @@ func (tree *Tree[K]) EqualOrSmaller(name K) (K, interface{}, bool) {
 }
 
 // Clear empties the tree without resetting the statistic metrics.
+// The keys are notified as deleted to the watchers and the OnDelete hook.
 func (tree *Tree[K]) Clear() {
 	tree.mutex.Lock()
 	defer tree.mutex.Unlock()
+	if tree.oplog != nil {
+		var none K
+		tree.record(OpLogClear, none, nil)
+	}
+	if tree.notify != nil {
+		tree.notifyClear()
+	}
 	tree.root = nil
 	tree.len = 0
+	tree.mem.reset()
+	if tree.ckpt != nil {
+		tree.ckpt.full = true
+		tree.ckpt.deleted.Clear()
+	}
+	if tree.pool != nil {
+		tree.pool.reset()
+	}
+	if tree.ttl != nil {
+		tree.ttl.reset()
+	}
+	if tree.evict != nil {
+		tree.evict.reset()
+	}
 }
 
 // Len returns the number of object stored.
 func (tree *Tree[K]) Len() int {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
 	return tree.len
 }
 
 // Stats returns a copy of the statistics metrics.
 func (tree *Tree[K]) Stats() Stats {
-	tree.stats.Put.Sum = tree.stats.Put.New + tree.stats.Put.Update
-	tree.stats.Get.Sum = tree.stats.Get.Found + tree.stats.Get.NotFound
-	tree.stats.Delete.Sum = tree.stats.Delete.Deleted + tree.stats.Delete.NotFound
-	tree.stats.Perf = pstats
-	tree.stats.Perf.Rotate.Sum = tree.stats.Perf.Rotate.Left + tree.stats.Perf.Rotate.Right
-	return tree.stats
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	s := tree.stats.snapshot()
+	s.Memory.Nodes = tree.mem.nodes
+	s.Memory.Keys = tree.mem.keys
+	s.Memory.Values = tree.mem.values
+	s.Memory.Sum = tree.mem.sum()
+	if tree.metrics != nil {
+		s.Ops = tree.metrics.load()
+	}
+	return s
 }
 
 // ResetStats resets all the satistics metrics.
 func (tree *Tree[K]) ResetStats() {
-	tree.stats = Stats{}
-	pstats = PerfStats{}
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.stats = Stats{Perf: loadPerf()}
+	if tree.metrics != nil {
+		tree.metrics.reset()
+	}
 }
 
 // String returns a pretty drawing of the tree structure.
@@ -235,7 +322,7 @@ func (tree *Tree[K]) String() string {
 	var buf bytes.Buffer
 	tree.mutex.RLock()
 	defer tree.mutex.RUnlock()
-	printNode(tree.root, &buf, nil, false)
+	printNode(tree.root, &buf)
 	return buf.String()
 }
 
@@ -268,25 +355,18 @@ func (s Stats) String() string {
 //	Black property: For each node, all simple paths from the node to
 //	                descendant leaves contain the same number of black nodes.
 //	LLRB property:  3-nodes always lean to the left and 4-nodes are balanced.
+//	Height bound:   The height is at most 2*log2(n+1).
 func (tree *Tree[K]) Check() error {
-	if err := checkRoot(tree.root); err != nil {
-		return err
-	}
-	if err := checkRed(tree.root); err != nil {
-		return err
-	}
-	length := 0
-	if err := checkBlack(tree.root, &length); err != nil {
-		return err
-	}
-	return checkLLRB(tree.root)
+	return tree.CheckContext(context.Background())
 }
 
 /*************************************************************************
  * Iterator
  ************************************************************************/
 
-// Iter is a iterator object.
+// Iter is a iterator object. It goes on after the keys are put or deleted.
+// With WithArena(), it finds its position again by the key after a delete
+// and stops after Clear().
 type Iter[K constraints.Ordered] struct {
 	tree *Tree[K]
 	cur  *Node[K] // cursor, start from
@@ -294,46 +374,104 @@ type Iter[K constraints.Ordered] struct {
 	end  K        // end boundary is span is set
 	span bool     // indicates the end boundary is set
 	done bool     // indicates the iteration is complete
+
+	name K           // key of the last node
+	data interface{} // value of the last node
+	key  K           // key of the cursor, to find it again with the arena
+	gen  uint64      // arena generation the cursor was taken at
+
+	ctx context.Context // stops the iteration when cancelled, optional
+	err error           // the context error stopped the iteration
 }
 
 // Iter returns an iterator.
 func (tree *Tree[K]) Iter() *Iter[K] {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
+	defer tree.runlock(opIter, tree.rlock())
 	it := &Iter[K]{
 		tree: tree,
 		cur:  findMin(tree.root),
 	}
-	if it.cur == nil {
-		it.done = true
-	}
+	it.track()
 	return it
 }
 
 // Range returns a ranged iterator.
 func (tree *Tree[K]) Range(start, end K) *Iter[K] {
-	tree.mutex.RLock()
-	defer tree.mutex.RUnlock()
+	defer tree.runlock(opRange, tree.rlock())
 	it := &Iter[K]{
 		tree: tree,
 		cur:  tree.bigger(tree.root, start, true),
 		end:  end,
 		span: true,
 	}
-	if it.cur == nil {
-		it.done = true
+	it.track()
+	return it
+}
+
+// iterFrom returns an iterator starting from the given key or the next bigger key.
+func (tree *Tree[K]) iterFrom(start K, equal bool) *Iter[K] {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	it := &Iter[K]{
+		tree: tree,
+		cur:  tree.bigger(tree.root, start, equal),
 	}
+	it.track()
 	return it
 }
 
 // Next travels the keys in the tree.
 func (it *Iter[K]) Next() bool {
+	if it.ctx != nil && !it.done {
+		if it.err = it.ctx.Err(); it.err != nil {
+			it.done = true
+			return false
+		}
+	}
+	defer it.tree.runlock(opIterNext, it.tree.rlock())
+	if pool := it.tree.pool; pool != nil && it.gen != pool.gen && !it.done {
+		it.reseek(pool)
+	}
+	for it.next() {
+		// skip the expired keys
+		if !it.tree.isExpired(it.last.name) {
+			it.name, it.data = it.last.name, it.last.data
+			return true
+		}
+	}
+	return false
+}
+
+// track checks the cursor and keeps its key and the arena generation after
+// the cursor moved. The caller must hold the read lock.
+func (it *Iter[K]) track() {
+	if it.cur == nil || (it.span && it.tree.isLess(it.end, it.cur.name)) {
+		it.done = true
+		return
+	}
+	if pool := it.tree.pool; pool != nil {
+		it.key, it.gen = it.cur.name, pool.gen
+	}
+}
+
+// reseek finds the cursor again by its key after some nodes were released
+// to the arena, since they may be reused for other keys. The iteration
+// stops if the tree has been cleared since.
+func (it *Iter[K]) reseek(pool *nodePool[K]) {
+	if it.gen < pool.cleared {
+		it.done = true
+		return
+	}
+	it.cur = it.tree.bigger(it.tree.root, it.key, true)
+	it.track()
+}
+
+// next moves the cursor to the next node. The caller must hold the read lock.
+func (it *Iter[K]) next() bool {
 	if it.done {
 		return false
 	}
 	it.last = it.cur
-	it.tree.mutex.RLock()
-	defer it.tree.mutex.RUnlock()
 	if it.cur = it.tree.bigger(it.cur.right, it.cur.name, false); it.cur == nil {
 		it.cur = it.last.up
 		// go up until bigger value found
@@ -344,31 +482,25 @@ func (it *Iter[K]) Next() bool {
 		if it.cur != nil {
 			it.cur = it.tree.bigger(it.cur, it.last.name, false)
 		}
-		if it.cur == nil {
-			it.done = true
-		}
-	}
-	if !it.done && it.span && it.tree.isLess(it.end, it.cur.name) {
-		it.done = true
 	}
+	it.track()
 	return true
 }
 
 // Key returns the key name.
 func (it *Iter[K]) Key() K {
-	if it.last == nil {
-		var k K
-		return k
-	}
-	return it.last.name
+	return it.name
 }
 
 // Val returns the value data.
 func (it *Iter[K]) Val() interface{} {
-	if it.last == nil {
-		return nil
-	}
-	return it.last.data
+	return it.data
+}
+
+// Err returns the context error if the iteration has been stopped by
+// the cancellation of the context given to IterContext().
+func (it *Iter[K]) Err() error {
+	return it.err
 }
 
 /*************************************************************************
@@ -383,150 +515,406 @@ func IsLess[K constraints.Ordered](a, b K) bool {
 	return a < b
 }
 
+// CompareFunc is the three-way comparator type. It returns a negative
+// number if a < b, zero if a == b, or a positive number if a > b.
+type CompareFunc[K constraints.Ordered] func(a, b K) int
+
+// lessToCompare makes a three-way comparator out of a less comparator.
+func lessToCompare[K constraints.Ordered](less Comparator[K]) CompareFunc[K] {
+	return func(a, b K) int {
+		if less(a, b) {
+			return -1
+		}
+		if less(b, a) {
+			return 1
+		}
+		return 0
+	}
+}
+
+// compareToLess makes a less comparator out of a three-way comparator.
+func compareToLess[K constraints.Ordered](compare CompareFunc[K]) Comparator[K] {
+	return func(a, b K) bool {
+		return compare(a, b) < 0
+	}
+}
+
 /*************************************************************************
  * User data manipulation functions
  ************************************************************************/
-func (tree *Tree[K]) put(node *Node[K], name K, data interface{}) *Node[K] {
-	if node == nil {
-		tree.len++
-		tree.stats.Put.New++
-		return newNode[K](name, data)
-	}
 
-	if LLRB234 {
-		// split 4-nodes on the way down
-		if isRed(node.left) && isRed(node.right) {
-			flipColor(node)
-		}
+// putLocked inserts or replaces the key and returns the previous value.
+// The caller must hold the write lock.
+func (tree *Tree[K]) putLocked(name K, data interface{}) (interface{}, bool) {
+	if tree.ttl != nil {
+		tree.expireLocked()
+	}
+	if tree.oplog != nil {
+		tree.record(OpLogPut, name, data)
 	}
+	if tree.trace != nil {
+		tree.traceStep(TracePut, name)
+	}
+	node, old, found := tree.put(name, data)
+	tree.root.red = false
+	if l := tree.log.Load(); l != nil && l.opts.Height && !found {
+		tree.logHeight(l, name)
+	}
+	tree.mem.put(name, old, data, found)
+	if tree.ttl != nil {
+		// by the key kept, which may differ from the one equal to it
+		tree.ttl.unset(node.name)
+	}
+	if tree.ckpt != nil {
+		markDirty(node)
+		tree.ckpt.deleted.Delete(name)
+	}
+	if tree.notify != nil {
+		tree.notifyPut(node.name, old, data, found)
+	}
+	if tree.evict != nil {
+		tree.evictLocked(node.name, found)
+	}
+	return old, found
+}
 
-	if tree.isLess(name, node.name) {
-		node.left = tree.put(node.left, name, data)
-		node.left.up = node
-	} else if tree.isLess(node.name, name) {
-		node.right = tree.put(node.right, name, data)
-		node.right.up = node
-	} else { // existing key found
-		node.data = data
-		tree.stats.Put.Update++
+// deleteLocked deletes the key and returns the deleted value.
+// The caller must hold the write lock.
+func (tree *Tree[K]) deleteLocked(name K) (interface{}, bool) {
+	if tree.ttl != nil {
+		tree.expireLocked()
 	}
+	old, deleted := tree.remove(name)
+	if deleted {
+		tree.stats.Delete.Deleted++
+	} else {
+		tree.stats.Delete.NotFound++
+	}
+	return old, deleted
+}
 
-	// fix right-leaning reds on the way up
-	if isRed(node.right) && !isRed(node.left) {
-		node = rotateLeft(node)
+// remove deletes the key along with its TTL and usage tracking and
+// notifies the deletion. It doesn't count the statistics.
+func (tree *Tree[K]) remove(name K) (interface{}, bool) {
+	if tree.oplog != nil {
+		tree.record(OpLogDelete, name, nil)
 	}
+	if tree.trace != nil {
+		tree.traceStep(TraceDelete, name)
+	}
+	stored := name // the key kept, which may differ from the one equal to it
+	if tree.ttl != nil || tree.evict != nil || tree.notify != nil || tree.mem.keySize != nil {
+		if node := tree.lookup(name); node != nil {
+			stored = node.name
+		}
+	}
+	old, deleted := tree.delete(name)
+	if tree.root != nil {
+		tree.root.red = false
+	}
+	if deleted {
+		tree.mem.remove(stored, old)
+		if tree.ckpt != nil {
+			tree.ckpt.deleted.Put(name, nil)
+		}
+	}
+	if tree.ttl != nil {
+		tree.ttl.unset(stored)
+	}
+	if tree.evict != nil && deleted {
+		tree.evict.remove(stored)
+	}
+	if tree.notify != nil && deleted {
+		tree.notifyDelete(stored, old)
+	}
+	return old, deleted
+}
 
-	// fix two reds in a row on the way up
-	if isRed(node.left) && isRed(node.left.left) {
-		node = rotateRight(node)
+// put inserts or replaces the key without recursion and returns the node
+// of the key. The 4-nodes are split
+// on the way down, then the path is fixed on the way up by walking the
+// parent links. The way up stops as soon as it gets two levels above the
+// shallowest change, since the fixes above there are no-ops.
+func (tree *Tree[K]) put(name K, data interface{}) (*Node[K], interface{}, bool) {
+	var old interface{}
+	var found bool
+	var parent *Node[K]
+	node := tree.root
+	depth, top := 0, math.MaxInt
+	c := 0
+	for node != nil {
+		if LLRB234 {
+			// split 4-nodes on the way down
+			if isRed(node.left) && isRed(node.right) {
+				tree.flipColor(node)
+				if depth < top {
+					top = depth
+				}
+			}
+		}
+
+		if c = tree.compare(name, node.name); c < 0 {
+			parent, node = node, node.left
+		} else if c > 0 {
+			parent, node = node, node.right
+		} else { // existing key found
+			old, found = node.data, true
+			node.data = data
+			tree.stats.Put.Update++
+			break
+		}
+		depth++
 	}
 
-	if !LLRB234 {
-		// split 4-nodes on the way up
-		if isRed(node.left) && isRed(node.right) {
-			flipColor(node)
+	if !found {
+		node = tree.allocNode(name, data)
+		node.up = parent
+		if parent == nil {
+			tree.root = node
+		} else if c < 0 {
+			parent.left = node
+		} else {
+			parent.right = node
+		}
+		tree.len++
+		tree.stats.Put.New++
+		if depth < top {
+			top = depth
 		}
 	}
 
-	// return new root
-	return node
+	// fix the path on the way up
+	leaf := node
+	for node != nil && depth+2 >= top {
+		var changed bool
+		if node, changed = tree.balance(node); changed && depth < top {
+			top = depth
+		}
+		node = node.up
+		depth--
+	}
+	addPerf(&tree.steps)
+	return leaf, old, found
 }
 
-func (tree *Tree[K]) delete(node *Node[K], name K) (*Node[K], bool) {
+// delete deletes the key without recursion. The red links are moved down
+// on the way down, then the path is fixed on the way up like put().
+func (tree *Tree[K]) delete(name K) (interface{}, bool) {
+	node := tree.root
 	if node == nil {
-		tree.stats.Delete.NotFound++
 		return nil, false
 	}
 
-	deleted := false
-	if tree.isLess(name, node.name) {
-		// move red left
-		if node.left != nil && (!isRed(node.left) && !isRed(node.left.left)) {
-			node = moveRedLeft(node)
-		}
-		// keep going down to the left
-		node.left, deleted = tree.delete(node.left, name)
-	} else { // right or equal
-		if isRed(node.left) {
-			node = rotateRight(node)
-		}
-		// remove if equal at the bottom
-		if node.right == nil && !tree.isLess(node.name, name) {
-			tree.len--
-			tree.stats.Delete.Deleted++
-			return nil, true
-		}
-		// move red right
-		if node.right != nil && (!isRed(node.right) && !isRed(node.right.left)) {
-			node = moveRedRight(node)
-		}
-		// found in the middle
-		if !tree.isLess(node.name, name) {
-			// we delete the min node from the right instead
-			var min *Node[K]
-			node.right, min = deleteMin(node.right)
-			// then copy the min node to this
-			node.name = min.name
-			node.data = min.data
-			tree.len--
-			tree.stats.Delete.Deleted++
-		} else {
+	var old interface{}
+	var match, leaf *Node[K]
+	depth, top := 0, math.MaxInt
+	for {
+		c := tree.compare(name, node.name)
+		if c < 0 {
+			// move red left
+			if node.left != nil && (!isRed(node.left) && !isRed(node.left.left)) {
+				node = tree.moveDown(node, tree.moveRedLeft(node))
+				if depth < top {
+					top = depth
+				}
+			}
+			if node.left == nil {
+				break // not found
+			}
+			// keep going down to the left
+			node = node.left
+		} else { // right or equal
+			if isRed(node.left) {
+				// the left child comes up, which is smaller than the key
+				node, c = tree.moveDown(node, tree.rotateRight(node)), 1
+				if depth < top {
+					top = depth
+				}
+			}
+			// remove if equal at the bottom
+			if node.right == nil && c == 0 {
+				old, leaf = node.data, node
+				break
+			}
+			// move red right
+			if node.right != nil && (!isRed(node.right) && !isRed(node.right.left)) {
+				if n := tree.moveDown(node, tree.moveRedRight(node)); n != node {
+					node, c = n, 1
+				}
+				if depth < top {
+					top = depth
+				}
+			}
+			// found in the middle
+			if c == 0 {
+				match = node
+				break
+			}
+			if node.right == nil {
+				break // not found
+			}
 			// keep going down to the right
-			node.right, deleted = tree.delete(node.right, name)
+			node = node.right
 		}
+		depth++
 	}
+
+	if match != nil {
+		// we delete the min node from the right instead
+		node = match.right
+		if tree.trace != nil {
+			tree.traceStep(TraceDeleteMin, node.name)
+		}
+		depth++
+		for node.left != nil {
+			if !isRed(node.left) && !isRed(node.left.left) {
+				node = tree.moveDown(node, tree.moveRedLeft(node))
+				if depth < top {
+					top = depth
+				}
+			}
+			node = node.left
+			depth++
+		}
+		// 3-nodes are left-leaning, so this is a leaf.
+		// then copy the min node to the matched one
+		old = match.data
+		match.name = node.name
+		match.data = node.data
+		match.dirty = node.dirty
+		leaf = node
+	}
+
+	if leaf != nil {
+		node = leaf.up
+		if node == nil {
+			tree.root = nil
+		} else if node.left == leaf {
+			node.left = nil
+		} else {
+			node.right = nil
+		}
+		tree.freeNode(leaf)
+		tree.len--
+		if depth < top {
+			top = depth
+		}
+		depth--
+	}
+
 	// fix right-leaning red nodes on the way up
-	return fixNode(node), deleted
+	for node != nil && depth+2 >= top {
+		var changed bool
+		if node, changed = tree.fixNode(node); changed && depth < top {
+			top = depth
+		}
+		node = node.up
+		depth--
+	}
+	addPerf(&tree.steps)
+	return old, leaf != nil
+}
+
+// moveDown links the node that took the position of the old one on the
+// way down of delete().
+func (tree *Tree[K]) moveDown(old, node *Node[K]) *Node[K] {
+	if node != old {
+		tree.replace(old, node)
+	}
+	return node
 }
 
 func (tree *Tree[K]) get(node *Node[K], name K) *Node[K] {
+	if node = tree.find(node, name); node != nil {
+		atomic.AddUint64(&tree.stats.Get.Found, 1)
+		if tree.evict != nil {
+			tree.evict.touch(node.name)
+		}
+		return node
+	}
+	atomic.AddUint64(&tree.stats.Get.NotFound, 1)
+	return nil
+}
+
+// find is same as get() but it doesn't count the statistics.
+// The expired keys are considered as not found.
+func (tree *Tree[K]) find(node *Node[K], name K) *Node[K] {
 	// do linear search for performance
 	for node != nil {
-		if tree.isLess(name, node.name) {
+		if c := tree.compare(name, node.name); c < 0 {
 			node = node.left
-		} else if tree.isLess(node.name, name) {
+		} else if c > 0 {
 			node = node.right
 		} else {
-			tree.stats.Get.Found++
+			if tree.isExpired(node.name) {
+				return nil
+			}
 			return node
 		}
 	}
-	tree.stats.Get.NotFound++
 	return nil
 }
 
-func (tree *Tree[K]) bigger(node *Node[K], name K, equal bool) *Node[K] {
-	if node == nil {
-		return nil
+// lookup is same as find() but finds the expired keys too.
+func (tree *Tree[K]) lookup(name K) *Node[K] {
+	node := tree.root
+	for node != nil {
+		if c := tree.compare(name, node.name); c < 0 {
+			node = node.left
+		} else if c > 0 {
+			node = node.right
+		} else {
+			return node
+		}
 	}
-	this := node
-	if tree.isLess(name, node.name) {
-		if node = tree.bigger(node.left, name, equal); node == nil {
-			node = this
+	return nil
+}
+
+func (tree *Tree[K]) bigger(node *Node[K], name K, equal bool) *Node[K] {
+	var found *Node[K]
+	for node != nil {
+		if c := tree.compare(name, node.name); c < 0 {
+			found = node
+			node = node.left
+		} else if c > 0 || !equal {
+			// continue to the right, also when the match is found
+			node = node.right
+		} else {
+			return node
 		}
-	} else if tree.isLess(node.name, name) {
-		node = tree.bigger(node.right, name, equal)
-	} else if !equal {
-		// match found, continue to the right
-		node = tree.bigger(node.right, name, equal)
 	}
-	return node
+	return found
 }
 
 func (tree *Tree[K]) smaller(node *Node[K], name K, equal bool) *Node[K] {
-	if node == nil {
-		return nil
-	}
-	this := node
-	if tree.isLess(name, node.name) {
-		node = tree.smaller(node.left, name, equal)
-	} else if tree.isLess(node.name, name) {
-		if node = tree.smaller(node.right, name, equal); node == nil {
-			node = this
+	var found *Node[K]
+	for node != nil {
+		if c := tree.compare(name, node.name); c > 0 {
+			found = node
+			node = node.right
+		} else if c < 0 || !equal {
+			// continue to the left, also when the match is found
+			node = node.left
+		} else {
+			return node
 		}
-	} else if !equal {
-		// match found, continue to the left
-		node = tree.smaller(node.left, name, equal)
+	}
+	return found
+}
+
+// skipBigger moves on to the bigger keys while the key of the node has
+// expired. The caller must hold the lock.
+func (tree *Tree[K]) skipBigger(node *Node[K]) *Node[K] {
+	for node != nil && tree.isExpired(node.name) {
+		node = tree.bigger(tree.root, node.name, false)
+	}
+	return node
+}
+
+// skipSmaller is same as skipBigger() but moves on to the smaller keys.
+func (tree *Tree[K]) skipSmaller(node *Node[K]) *Node[K] {
+	for node != nil && tree.isExpired(node.name) {
+		node = tree.smaller(tree.root, node.name, false)
 	}
 	return node
 }
@@ -535,8 +923,67 @@ func (tree *Tree[K]) smaller(node *Node[K], name K, equal bool) *Node[K] {
  * Tree property management functions
  ************************************************************************/
 
+// pstats is shared by all the trees, so it's updated atomically. It's
+// never reset to keep the exported counters monotonic.
 var pstats PerfStats
 
+// addPerf adds the steps of a write to the shared counters. The steps are
+// counted in the tree under the write lock and added once per write, since
+// the atomic updates per step cost more than the steps themselves.
+func addPerf(steps *PerfStats) {
+	if steps.Flip != 0 {
+		atomic.AddUint64(&pstats.Flip, steps.Flip)
+	}
+	if steps.Rotate.Left != 0 {
+		atomic.AddUint64(&pstats.Rotate.Left, steps.Rotate.Left)
+	}
+	if steps.Rotate.Right != 0 {
+		atomic.AddUint64(&pstats.Rotate.Right, steps.Rotate.Right)
+	}
+	*steps = PerfStats{}
+}
+
+// loadPerf returns the shared counters.
+func loadPerf() PerfStats {
+	var p PerfStats
+	p.Flip = atomic.LoadUint64(&pstats.Flip)
+	p.Rotate.Left = atomic.LoadUint64(&pstats.Rotate.Left)
+	p.Rotate.Right = atomic.LoadUint64(&pstats.Rotate.Right)
+	p.Rotate.Sum = p.Rotate.Left + p.Rotate.Right
+	return p
+}
+
+// snapshot copies the counters and fills in the sums. The caller must hold
+// the read lock. The Get counters are loaded atomically since the readers
+// update them under the read lock. Perf keeps the shared counters at the
+// last reset, so the counts since then are reported.
+func (s *Stats) snapshot() Stats {
+	c := Stats{
+		Put:     s.Put,
+		Delete:  s.Delete,
+		Expired: s.Expired,
+		Evicted: s.Evicted,
+	}
+	c.Get.Found = atomic.LoadUint64(&s.Get.Found)
+	c.Get.NotFound = atomic.LoadUint64(&s.Get.NotFound)
+	c.Put.Sum = c.Put.New + c.Put.Update
+	c.Get.Sum = c.Get.Found + c.Get.NotFound
+	c.Delete.Sum = c.Delete.Deleted + c.Delete.NotFound
+	c.Perf = perfSince(s.Perf)
+	return c
+}
+
+// perfSince returns the shared counters counted after the base.
+func perfSince(base PerfStats) PerfStats {
+	var c PerfStats
+	p := loadPerf()
+	c.Flip = p.Flip - base.Flip
+	c.Rotate.Left = p.Rotate.Left - base.Rotate.Left
+	c.Rotate.Right = p.Rotate.Right - base.Rotate.Right
+	c.Rotate.Sum = c.Rotate.Left + c.Rotate.Right
+	return c
+}
+
 func newNode[K constraints.Ordered](name K, data interface{}) *Node[K] {
 	return &Node[K]{
 		name: name,
@@ -545,6 +992,19 @@ func newNode[K constraints.Ordered](name K, data interface{}) *Node[K] {
 	}
 }
 
+func (tree *Tree[K]) allocNode(name K, data interface{}) *Node[K] {
+	if tree.pool != nil {
+		return tree.pool.alloc(name, data)
+	}
+	return newNode(name, data)
+}
+
+func (tree *Tree[K]) freeNode(node *Node[K]) {
+	if tree.pool != nil {
+		tree.pool.release(node)
+	}
+}
+
 func isRed[K constraints.Ordered](node *Node[K]) bool {
 	if node == nil {
 		return false
@@ -552,58 +1012,111 @@ func isRed[K constraints.Ordered](node *Node[K]) bool {
 	return node.red
 }
 
-func flipColor[K constraints.Ordered](node *Node[K]) {
+func (tree *Tree[K]) flipColor(node *Node[K]) {
 	node.red = !node.red
 	node.left.red = !node.left.red
 	node.right.red = !node.right.red
-	pstats.Flip++
+	tree.steps.Flip++
+	if tree.metrics != nil {
+		tree.metrics.flips++
+	}
+	if tree.trace != nil {
+		tree.traceStep(TraceFlipColor, node.name)
+	}
+}
+
+// replace links the node to the parent in place of the old node after
+// the node took the old node's position by rotations. The rotations leave
+// it to the caller, which assigns the node returned in most cases.
+func (tree *Tree[K]) replace(old, node *Node[K]) {
+	if parent := node.up; parent == nil {
+		tree.root = node
+	} else if parent.left == old {
+		parent.left = node
+	} else if parent.right == old {
+		parent.right = node
+	}
 }
 
-func rotateLeft[K constraints.Ordered](node *Node[K]) *Node[K] {
+func (tree *Tree[K]) rotateLeft(node *Node[K]) *Node[K] {
 	n := node.right
-	n.up = node.up
-	node.up = n
+	n.up, node.up = node.up, n
 	node.right = n.left
+	if node.right != nil {
+		node.right.up = node
+	}
 	n.left = node
-	n.red = n.left.red
-	n.left.red = true
-	pstats.Rotate.Left++
+	n.red, node.red = node.red, true
+	// the top keeps the marks of the subtree, which the node lost a part of
+	if node.dirtySub {
+		n.dirtySub = true
+		node.dirtySub = node.dirty || hasDirty(node.left) || hasDirty(node.right)
+	}
+	tree.steps.Rotate.Left++
+	if tree.metrics != nil {
+		tree.metrics.rotates++
+	}
+	if tree.trace != nil {
+		// link it up now for the snapshot from the root
+		tree.replace(node, n)
+		tree.traceStep(TraceRotateLeft, node.name)
+	}
 	return n
 }
 
-func rotateRight[K constraints.Ordered](node *Node[K]) *Node[K] {
+func (tree *Tree[K]) rotateRight(node *Node[K]) *Node[K] {
 	n := node.left
-	n.up = node.up
-	node.up = n
+	n.up, node.up = node.up, n
 	node.left = n.right
+	if node.left != nil {
+		node.left.up = node
+	}
 	n.right = node
-	n.red = n.right.red
-	n.right.red = true
-	pstats.Rotate.Right++
+	n.red, node.red = node.red, true
+	// the top keeps the marks of the subtree, which the node lost a part of
+	if node.dirtySub {
+		n.dirtySub = true
+		node.dirtySub = node.dirty || hasDirty(node.left) || hasDirty(node.right)
+	}
+	tree.steps.Rotate.Right++
+	if tree.metrics != nil {
+		tree.metrics.rotates++
+	}
+	if tree.trace != nil {
+		// link it up now for the snapshot from the root
+		tree.replace(node, n)
+		tree.traceStep(TraceRotateRight, node.name)
+	}
 	return n
 }
 
-func moveRedLeft[K constraints.Ordered](node *Node[K]) *Node[K] {
-	flipColor(node)
+func (tree *Tree[K]) moveRedLeft(node *Node[K]) *Node[K] {
+	if tree.trace != nil {
+		tree.traceStep(TraceMoveRedLeft, node.name)
+	}
+	tree.flipColor(node)
 	if isRed(node.right.left) {
-		node.right = rotateRight(node.right)
-		node = rotateLeft(node)
-		flipColor(node)
+		node.right = tree.rotateRight(node.right)
+		node = tree.rotateLeft(node)
+		tree.flipColor(node)
 		if LLRB234 {
 			// 2-3-4 exclusive
 			if isRed(node.right.right) {
-				node.right = rotateLeft(node.right)
+				node.right = tree.rotateLeft(node.right)
 			}
 		}
 	}
 	return node
 }
 
-func moveRedRight[K constraints.Ordered](node *Node[K]) *Node[K] {
-	flipColor(node)
+func (tree *Tree[K]) moveRedRight(node *Node[K]) *Node[K] {
+	if tree.trace != nil {
+		tree.traceStep(TraceMoveRedRight, node.name)
+	}
+	tree.flipColor(node)
 	if isRed(node.left.left) {
-		node = rotateRight(node)
-		flipColor(node)
+		node = tree.rotateRight(node)
+		tree.flipColor(node)
 	}
 	return node
 }
@@ -630,41 +1143,62 @@ func findMax[K constraints.Ordered](node *Node[K]) *Node[K] {
 	return node
 }
 
-func deleteMin[K constraints.Ordered](node *Node[K]) (*Node[K], *Node[K]) {
-	if node.left == nil {
-		// 3-nodes are left-leaning, so this is a leaf.
-		return nil, node
+// balance fixes the node on the way up of put(). It returns the new node
+// at the position and true if the change can be seen from the parent.
+func (tree *Tree[K]) balance(node *Node[K]) (*Node[K], bool) {
+	this, red := node, node.red
+
+	// fix right-leaning reds on the way up
+	if isRed(node.right) && !isRed(node.left) {
+		node = tree.rotateLeft(node)
+	}
+
+	// fix two reds in a row on the way up
+	if isRed(node.left) && isRed(node.left.left) {
+		node = tree.rotateRight(node)
+	}
+
+	if !LLRB234 {
+		// split 4-nodes on the way up
+		if isRed(node.left) && isRed(node.right) {
+			tree.flipColor(node)
+		}
 	}
-	if !isRed(node.left) && !isRed(node.left.left) {
-		node = moveRedLeft(node)
+	if node != this {
+		tree.replace(this, node)
 	}
-	var min *Node[K]
-	node.left, min = deleteMin(node.left)
-	return fixNode(node), min
+	return node, node != this || node.red != red
 }
 
-func fixNode[K constraints.Ordered](node *Node[K]) *Node[K] {
+// fixNode fixes the node on the way up of delete(). It returns the new
+// node at the position and true if the change can be seen from the parent.
+func (tree *Tree[K]) fixNode(node *Node[K]) (*Node[K], bool) {
+	this, red := node, node.red
+
 	// rotate right red to left
 	if isRed(node.right) {
 		if LLRB234 {
 			if isRed(node.right.left) {
-				node.right = rotateRight(node.right)
+				node.right = tree.rotateRight(node.right)
 			}
 		}
-		node = rotateLeft(node)
+		node = tree.rotateLeft(node)
 	}
 	// rotate left red-red to right
 	if isRed(node.left) && isRed(node.left.left) {
-		node = rotateRight(node)
+		node = tree.rotateRight(node)
 	}
 
 	if !LLRB234 {
 		// split 4-nodes
 		if isRed(node.left) && isRed(node.right) {
-			flipColor(node)
+			tree.flipColor(node)
 		}
 	}
-	return node
+	if node != this {
+		tree.replace(this, node)
+	}
+	return node, node != this || node.red != red
 }
 
 /*************************************************************************
@@ -674,134 +1208,156 @@ func fixNode[K constraints.Ordered](node *Node[K]) *Node[K] {
 // checkRoot verifies that root property of the red-black tree is satisfied.
 func checkRoot[K constraints.Ordered](root *Node[K]) error {
 	if isRed(root) {
-		return fmt.Errorf("root property violation found")
+		return ErrRootProperty
 	}
 
 	return nil
 }
 
 // checkRed verifies that red property of the red-black tree is satisfied.
-func checkRed[K constraints.Ordered](node *Node[K]) error {
-	if node == nil {
-		return nil
-	}
+func checkRed[K constraints.Ordered](ctx context.Context, root *Node[K]) error {
+	poll := ctxPoller{ctx: ctx}
+	stack := append(make([]*Node[K], 0, 64), root)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		if err := poll.err(); err != nil {
+			return err
+		}
 
-	if isRed(node) && (isRed(node.right) || isRed(node.left)) {
-		return fmt.Errorf("red property violation found")
-	}
-	if err := checkRed(node.right); err != nil {
-		return err
+		if isRed(node) && (isRed(node.right) || isRed(node.left)) {
+			return ErrRedProperty
+		}
+		stack = append(stack, node.left, node.right)
 	}
-	return checkRed(node.left)
+	return nil
 }
 
 // checkBlack verifies that black property of the red-black tree is satisfied.
-func checkBlack[K constraints.Ordered](node *Node[K], length *int) error {
-	if node == nil {
-		*length = 1
-		return nil
+// The number of black nodes on the left-most path is compared with all the
+// other paths.
+func checkBlack[K constraints.Ordered](ctx context.Context, root *Node[K]) error {
+	poll := ctxPoller{ctx: ctx}
+	length := 0
+	for node := root; node != nil; node = node.left {
+		if !isRed(node) {
+			length++
+		}
 	}
 
-	var rightLength int
-	if err := checkBlack(node.right, &rightLength); err != nil {
-		return err
-	}
-	var leftLength int
-	if err := checkBlack(node.left, &leftLength); err != nil {
-		return err
+	type pathObj struct {
+		node   *Node[K]
+		blacks int
 	}
+	stack := append(make([]pathObj, 0, 64), pathObj{node: root})
+	for len(stack) > 0 {
+		path := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if path.node == nil {
+			if path.blacks != length {
+				return ErrBlackProperty
+			}
+			continue
+		}
+		if err := poll.err(); err != nil {
+			return err
+		}
 
-	if rightLength != leftLength {
-		return fmt.Errorf("black property violation found")
-	}
-	if !isRed(node) {
-		*length = rightLength + 1
-	} else {
-		*length = rightLength
+		if !isRed(path.node) {
+			path.blacks++
+		}
+		stack = append(stack,
+			pathObj{node: path.node.left, blacks: path.blacks},
+			pathObj{node: path.node.right, blacks: path.blacks})
 	}
 	return nil
 }
 
 // checkLLRB verifies that LLRB property of the left-leaning red-black tree is satisfied.
-func checkLLRB[K constraints.Ordered](node *Node[K]) error {
-	if node == nil {
-		return nil
-	}
+func checkLLRB[K constraints.Ordered](ctx context.Context, root *Node[K]) error {
+	poll := ctxPoller{ctx: ctx}
+	stack := append(make([]*Node[K], 0, 64), root)
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		if err := poll.err(); err != nil {
+			return err
+		}
 
-	if isRed(node.right) && !isRed(node.left) {
-		return fmt.Errorf("LLRB property violation found")
-	}
-	if err := checkLLRB(node.right); err != nil {
-		return err
+		if isRed(node.right) && !isRed(node.left) {
+			return ErrLLRBProperty
+		}
+		stack = append(stack, node.left, node.right)
 	}
-	return checkLLRB(node.left)
+	return nil
 }
 
 /*************************************************************************
  * Tree printing functions
  ************************************************************************/
 
-type branchObj struct {
-	prev *branchObj
-	str  string
-}
-
-func printBranch(branch *branchObj, out *bytes.Buffer) {
-	if branch == nil {
-		return
-	}
-	printBranch(branch.prev, out)
-	out.WriteString(branch.str)
-}
-
-func printNode[K constraints.Ordered](node *Node[K], out *bytes.Buffer, pbranch *branchObj, right bool) {
-	if node == nil {
-		return
-	}
-
-	branch := &branchObj{
-		prev: pbranch,
-	}
-
-	if pbranch != nil {
-		if right {
-			branch.str = "    "
-		} else {
-			branch.str = "│   "
+// printNode prints the tree sideways, the right subtree on top, walking
+// the nodes in the reverse order without recursion.
+func printNode[K constraints.Ordered](root *Node[K], out *bytes.Buffer) {
+	type lineObj struct {
+		node   *Node[K]
+		prefix string // printed before the node
+		right  bool
+	}
+
+	// children returns the branches of the child nodes.
+	children := func(b lineObj) (lineObj, lineObj) {
+		var rstr, lstr string
+		if b.node != root {
+			if b.right {
+				rstr, lstr = "    ", "│   "
+			} else {
+				rstr, lstr = "│   ", "    "
+			}
 		}
-	} else {
-		branch.str = ""
+		return lineObj{node: b.node.right, prefix: b.prefix + rstr, right: true},
+			lineObj{node: b.node.left, prefix: b.prefix + lstr, right: false}
 	}
-	printNode(node.right, out, branch, true)
 
-	printBranch(pbranch, out)
-	if pbranch != nil {
-		if right {
-			out.WriteString("┌──")
-		} else {
-			out.WriteString("└──")
+	var stack []lineObj
+	branch := lineObj{node: root}
+	for branch.node != nil || len(stack) > 0 {
+		for branch.node != nil {
+			stack = append(stack, branch)
+			branch, _ = children(branch)
 		}
-		if node.red {
+		branch = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node := branch.node
+		out.WriteString(branch.prefix)
+		if node != root {
+			if branch.right {
+				out.WriteString("┌──")
+			} else {
+				out.WriteString("└──")
+			}
+			if node.red {
+				out.WriteString("[")
+			} else {
+				out.WriteString("─")
+			}
+		} else if node.red {
+			// the root is red only in the middle of the changes
 			out.WriteString("[")
-		} else {
-			out.WriteString("─")
 		}
-	}
-	out.WriteString(fmt.Sprintf("%v", node.name))
-	if node.red {
-		out.WriteString("]\n")
-	} else {
-		out.WriteString(" \n")
-	}
-
-	if pbranch != nil {
-		if right {
-			branch.str = "│   "
+		out.WriteString(fmt.Sprintf("%v", node.name))
+		if node.red {
+			out.WriteString("]\n")
 		} else {
-			branch.str = "    "
+			out.WriteString(" \n")
 		}
-	} else {
-		branch.str = ""
+		_, branch = children(branch)
 	}
-	printNode(node.left, out, branch, false)
 }
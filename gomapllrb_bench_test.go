@@ -4,6 +4,8 @@ package gomapllrb
 
 import (
 	"fmt"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -30,9 +32,32 @@ func TestBenchmarkAscending(t *testing.T) {
 	perfTest(t, keys)
 }
 
-func perfTest(t *testing.T, keys []uint32) {
+func TestBenchmarkArenaRandom(t *testing.T) {
+	title("Test perfmance / random with arena")
+	num := 1000000
+	keys := make([]uint32, num, num)
+	for i := 0; i < num; i++ {
+		keys[i] = hash32(i)
+	}
+	perfTest(t, keys, WithArena(4096))
+}
+
+func TestBenchmarkArenaAscending(t *testing.T) {
+	title("Test perfmance / ascending with arena")
+	num := 1000000
+	keys := make([]uint32, num, num)
+	for i := 0; i < num; i++ {
+		keys[i] = uint32(i)
+	}
+	perfTest(t, keys, WithArena(4096))
+}
+
+func perfTest(t *testing.T, keys []uint32, opts ...Option) {
 	assert := assert.New(t)
-	tree := New[uint32]()
+	tree := New[uint32](opts...)
+	runtime.GC()
+	var mstart runtime.MemStats
+	runtime.ReadMemStats(&mstart)
 
 	// print key samples
 	fmt.Printf("  Sample")
@@ -85,4 +110,83 @@ func perfTest(t *testing.T, keys []uint32) {
 	fmt.Printf("  Delete %d keys:\t%vms (%v)\n", len(keys), time.Since(start).Milliseconds(), stats)
 	assert.Equal(0, tree.Len())
 	assertTreeCheck(t, tree, false)
+
+	// gc
+	var mend runtime.MemStats
+	runtime.ReadMemStats(&mend)
+	fmt.Printf("  GC:\t%d cycles, %vms paused, %d objects allocated\n", mend.NumGC-mstart.NumGC,
+		time.Duration(mend.PauseTotalNs-mstart.PauseTotalNs).Milliseconds(), mend.Mallocs-mstart.Mallocs)
+}
+
+func TestBenchmarkCompactMemory(t *testing.T) {
+	title("Test memory usage / Tree vs CompactTree")
+	num := 1000000
+	heapAlloc := func() uint64 {
+		var m runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&m)
+		return m.HeapAlloc
+	}
+
+	start := heapAlloc()
+	tree := New[uint32]()
+	for i := 0; i < num; i++ {
+		tree.Put(hash32(i), nil)
+	}
+	used := heapAlloc() - start
+	fmt.Printf("  Tree:\t\t%d bytes per key\n", used/uint64(tree.Len()))
+	runtime.KeepAlive(tree)
+
+	start = heapAlloc()
+	compact := NewCompact[uint32]()
+	for i := 0; i < num; i++ {
+		compact.Put(hash32(i), nil)
+	}
+	used = heapAlloc() - start
+	fmt.Printf("  CompactTree:\t%d bytes per key\n", used/uint64(compact.Len()))
+	runtime.KeepAlive(compact)
+}
+
+func BenchmarkCheck(b *testing.B) {
+	keys := benchKeys(100000)
+	tree := New[uint32]()
+	for _, k := range keys {
+		tree.Put(k, nil)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Check()
+	}
+}
+
+// long keys sharing a prefix make the comparisons expensive
+func benchStringKeys(num int) []string {
+	keys := make([]string, num)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s%010d", strings.Repeat("key/", 32), hash32(i))
+	}
+	return keys
+}
+
+func benchGetString(b *testing.B, tree *Tree[string]) {
+	keys := benchStringKeys(100000)
+	for _, k := range keys {
+		tree.Put(k, nil)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Get(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkGetStringLess(b *testing.B) {
+	tree := New[string]()
+	tree.SetLess(func(a, b string) bool { return a < b })
+	benchGetString(b, tree)
+}
+
+func BenchmarkGetStringCompare(b *testing.B) {
+	tree := New[string]()
+	tree.SetCompare(strings.Compare)
+	benchGetString(b, tree)
 }
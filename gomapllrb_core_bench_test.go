@@ -0,0 +1,65 @@
+//go:build bench
+
+package gomapllrb
+
+import (
+	"testing"
+)
+
+// Go benchmarks of the core operations. They use only the API of the
+// first release, so the file can be copied onto an older tree to compare
+// with, which `make benchcmp` does. Run with:
+//
+//	go test -tags bench -run XXX -bench .
+func benchKeys(num int) []uint32 {
+	keys := make([]uint32, num)
+	for i := range keys {
+		keys[i] = hash32(i)
+	}
+	return keys
+}
+
+func BenchmarkPut(b *testing.B) {
+	keys := benchKeys(b.N)
+	tree := New[uint32]()
+	b.ResetTimer()
+	for _, k := range keys {
+		tree.Put(k, nil)
+	}
+}
+
+func BenchmarkDelete(b *testing.B) {
+	keys := benchKeys(b.N)
+	tree := New[uint32]()
+	for _, k := range keys {
+		tree.Put(k, nil)
+	}
+	b.ResetTimer()
+	for _, k := range keys {
+		tree.Delete(k)
+	}
+}
+
+func BenchmarkBigger(b *testing.B) {
+	keys := benchKeys(1000000)
+	tree := New[uint32]()
+	for _, k := range keys {
+		tree.Put(k, nil)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Bigger(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkSmaller(b *testing.B) {
+	keys := benchKeys(1000000)
+	tree := New[uint32]()
+	for _, k := range keys {
+		tree.Put(k, nil)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.Smaller(keys[i%len(keys)])
+	}
+}
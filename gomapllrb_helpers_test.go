@@ -41,6 +41,8 @@ func assertTreeCheck[K constraints.Ordered](t interface{}, tree *Tree[K], verbos
 	}
 	if verbose {
 		fmt.Print(tree)
-		fmt.Printf("(#nodes %d, #red %d, #black %d\n", tree.Len(), 0, 0)
+		s := tree.Shape()
+		fmt.Printf("(#nodes %d, #red %d, #black %d, height %d, black height %d)\n",
+			s.Len, s.Red, s.Black, s.Height, s.BlackHeight)
 	}
 }
@@ -4,6 +4,7 @@ package gomapllrb
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -131,6 +132,49 @@ func TestBasics(t *testing.T) {
 	assert.Equal(0, tree.Len())
 }
 
+func TestCompare(t *testing.T) {
+	title("Test SetLess() and SetCompare()")
+	assert := assert.New(t)
+
+	// reverse order
+	less := New[int]()
+	less.SetLess(func(a, b int) bool { return a > b })
+	compare := New[int]()
+	compare.SetCompare(func(a, b int) int { return b - a })
+	for _, tree := range []*Tree[int]{less, compare} {
+		for i := 0; i < 100; i++ {
+			tree.Put(i, i)
+		}
+		assertTreeCheck(t, tree, false)
+		k, _, _ := tree.Min()
+		assert.Equal(99, k)
+		k, _, _ = tree.Bigger(50)
+		assert.Equal(49, k)
+		k, _, _ = tree.Smaller(50)
+		assert.Equal(51, k)
+		assert.True(tree.Delete(50))
+		assert.False(tree.Exist(50))
+		assertTreeCheck(t, tree, false)
+	}
+	assert.Equal(less.String(), compare.String())
+
+	// one comparison per level
+	calls := 0
+	tree := New[int]()
+	tree.SetCompare(func(a, b int) int {
+		calls++
+		return a - b
+	})
+	for i := 0; i < 1023; i++ {
+		tree.Put(i, i)
+	}
+	for i := 0; i < 1023; i++ {
+		calls = 0
+		assert.True(tree.Exist(i))
+		assert.LessOrEqual(calls, 2*10)
+	}
+}
+
 func TestGetters(t *testing.T) {
 	title("Test Getters")
 	assert := assert.New(t)
@@ -249,6 +293,90 @@ func TestIter(t *testing.T) {
 	assert.True(it.Next())
 	assert.Equal(7, it.Key())
 	assert.False(it.Next())
+
+	// iterate after deletions
+	tree = New[int]()
+	for i := 0; i < 1000; i++ {
+		tree.Put(i, i)
+	}
+	for i := 0; i < 1000; i += 3 {
+		assert.True(tree.Delete(i))
+	}
+	num := 0
+	for it = tree.Iter(); it.Next(); num++ {
+		assert.NotEqual(0, it.Key()%3)
+	}
+	assert.Equal(tree.Len(), num)
+}
+
+func TestConcurrentTrees(t *testing.T) {
+	title("Test Len() and the shared stats under concurrent writers")
+	assert := assert.New(t)
+
+	// Len() is read under the lock, and the rotation and flip counters
+	// shared by the trees are updated atomically. Run with -race.
+	trees := []*Tree[int]{New[int](), New[int]()}
+	var wg sync.WaitGroup
+	for _, tree := range trees {
+		wg.Add(2)
+		go func(tree *Tree[int]) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				tree.Put(int(hash32(i)%500), i)
+				tree.Delete(int(hash32(i+1) % 500))
+			}
+		}(tree)
+		go func(tree *Tree[int]) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				assert.LessOrEqual(tree.Len(), 500)
+			}
+		}(tree)
+	}
+	wg.Wait()
+
+	// the parent links are kept on the way for the iterators
+	for _, tree := range trees {
+		assert.NoError(tree.Validate())
+		num := 0
+		for it := tree.Iter(); it.Next(); num++ {
+		}
+		assert.Equal(tree.Len(), num)
+	}
+}
+
+func TestConcurrentStats(t *testing.T) {
+	title("Test Stats() under concurrent readers and writers")
+	assert := assert.New(t)
+
+	// Stats() doesn't write to the tree, and the Get counters updated
+	// under the read lock are atomic. Run with -race.
+	tree, compact := New[int](), NewCompact[int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 3; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				switch g {
+				case 0:
+					tree.Put(i, i)
+					compact.Put(i, i)
+				case 1:
+					tree.Get(i)
+					compact.Get(i)
+				default:
+					tree.Stats()
+					compact.Stats()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for _, s := range []Stats{tree.Stats(), compact.Stats()} {
+		assert.Equal(uint64(1000), s.Put.Sum)
+		assert.Equal(uint64(1000), s.Get.Sum)
+	}
 }
 
 func TestMap(t *testing.T) {
@@ -335,3 +463,68 @@ func TestCheck(t *testing.T) {
 	tree.root.left.left = n
 	assert.NoError(tree.Check())
 }
+
+func TestRandomOps(t *testing.T) {
+	title("Test random puts and deletes against a map")
+	assert := assert.New(t)
+	tree := New[int]()
+	m := make(map[int]interface{})
+
+	// verifies the parent links which put() and delete() rely on
+	var checkUp func(node *Node[int]) int
+	checkUp = func(node *Node[int]) int {
+		if node == nil {
+			return 0
+		}
+		if node.left != nil {
+			assert.Same(node, node.left.up)
+		}
+		if node.right != nil {
+			assert.Same(node, node.right.up)
+		}
+		return checkUp(node.left) + checkUp(node.right) + 1
+	}
+
+	for i := 0; i < 20000; i++ {
+		k := int(hash32(i) % 1000)
+		if hash32(i+1000000)%3 == 0 {
+			_, found := m[k]
+			assert.Equal(found, tree.Delete(k))
+			delete(m, k)
+		} else {
+			tree.Put(k, i)
+			m[k] = i
+		}
+		if i%1000 == 0 {
+			assertTreeCheck(t, tree, false)
+			assert.Equal(len(m), checkUp(tree.root))
+		}
+	}
+	assertTreeCheck(t, tree, false)
+	assert.Nil(tree.root.up)
+	assert.Equal(len(m), checkUp(tree.root))
+	assert.Equal(m, tree.Map())
+
+	// compare the lookups with a linear search
+	for k := -1; k <= 1000; k++ {
+		bigger, smaller := -1, -1
+		for n := range m {
+			if n > k && (bigger < 0 || n < bigger) {
+				bigger = n
+			}
+			if n < k && (smaller < 0 || n > smaller) {
+				smaller = n
+			}
+		}
+		n, _, ok := tree.Bigger(k)
+		assert.Equal(bigger >= 0, ok)
+		if ok {
+			assert.Equal(bigger, n)
+		}
+		n, _, ok = tree.Smaller(k)
+		assert.Equal(smaller >= 0, ok)
+		if ok {
+			assert.Equal(smaller, n)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package gomapllrb
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// LogOptions configures the logging enabled by SetLogger().
+type LogOptions struct {
+	// SlowOp logs the operations taking longer than this at the warning
+	// level, including the lock wait. Zero disables it.
+	SlowOp time.Duration
+	// Height logs the puts making the path to the key longer than the
+	// height bound of 2*log2(n+1) at the warning level. It costs a search
+	// per put.
+	Height bool
+}
+
+// SetLogger sets a logger to trace the slow or the suspicious operations.
+// Besides the options, the failures of Check() and the panics in the
+// operations, such as the comparator panics, are logged at the error level
+// with the key. The panics are re-raised after logged. This covers all the
+// operations on a key, including the conditional, TTL and context variants,
+// and Apply() which is logged without a key. Set nil to stop logging.
+//
+//	tree.SetLogger(slog.Default(), LogOptions{SlowOp: time.Millisecond, Height: true})
+func (tree *Tree[K]) SetLogger(logger *slog.Logger, opts LogOptions) {
+	if logger == nil {
+		tree.log.Store(nil)
+		return
+	}
+	tree.log.Store(&treeLog{logger: logger, opts: opts})
+}
+
+/*************************************************************************
+ * Logging functions
+ ************************************************************************/
+
+type treeLog struct {
+	logger *slog.Logger
+	opts   LogOptions
+}
+
+var opNames = [numOps]string{
+	opPut:      "put",
+	opDelete:   "delete",
+	opGet:      "get",
+	opMin:      "min",
+	opMax:      "max",
+	opBigger:   "bigger",
+	opSmaller:  "smaller",
+	opIter:     "iter",
+	opRange:    "range",
+	opIterNext: "iter_next",
+	opApply:    "apply",
+}
+
+// keyAttrs returns the attributes of the operation and the key if given.
+func keyAttrs[K any](op opType, name *K) []any {
+	if name == nil {
+		return []any{slog.String("op", opNames[op])}
+	}
+	return []any{slog.String("op", opNames[op]), slog.Any("key", *name)}
+}
+
+func logSlow[K any](l *treeLog, op opType, name *K, elapsed time.Duration) {
+	if l.opts.SlowOp > 0 && elapsed > l.opts.SlowOp {
+		l.logger.Warn("gomapllrb: slow operation",
+			append(keyAttrs(op, name), slog.Duration("elapsed", elapsed))...)
+	}
+}
+
+func logPanic[K any](l *treeLog, op opType, name *K, r interface{}) {
+	l.logger.Error("gomapllrb: operation panicked",
+		append(keyAttrs(op, name), slog.Any("panic", r))...)
+}
+
+// logHeight logs if the path to the key put is longer than the bound.
+// The caller must hold the write lock.
+func (tree *Tree[K]) logHeight(l *treeLog, name K) {
+	depth := 0
+	for node := tree.root; node != nil; depth++ {
+		c := tree.compare(name, node.name)
+		if c == 0 {
+			break
+		}
+		if c < 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	if float64(depth+1) > 2*math.Log2(float64(tree.len+1)) {
+		l.logger.Warn("gomapllrb: height bound exceeded",
+			slog.String("op", opNames[opPut]), slog.Any("key", name),
+			slog.Int("depth", depth), slog.Int("len", tree.len))
+	}
+}
+
+func (tree *Tree[K]) logRecord(op string, name K, err error) {
+	if l := tree.log.Load(); l != nil {
+		l.logger.Error("gomapllrb: recording stopped",
+			slog.String("op", op), slog.Any("key", name), slog.Any("error", err))
+	}
+}
+
+func (tree *Tree[K]) logCheck(ctx context.Context, err error) {
+	if l := tree.log.Load(); l != nil && ctx.Err() == nil {
+		l.logger.Error("gomapllrb: check failed", slog.Any("error", err), slog.Int("len", tree.len))
+	}
+}
@@ -0,0 +1,105 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLogger(t *testing.T) {
+	title("Test SetLogger()")
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "elapsed" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	// slow operations
+	tree := New[string]()
+	tree.SetLogger(logger, LogOptions{SlowOp: time.Nanosecond})
+	tree.Put("A", 1)
+	tree.Get("A")
+	tree.Min()
+	assert.Equal(""+
+		"level=WARN msg=\"gomapllrb: slow operation\" op=put key=A\n"+
+		"level=WARN msg=\"gomapllrb: slow operation\" op=get key=A\n"+
+		"level=WARN msg=\"gomapllrb: slow operation\" op=min\n", buf.String())
+
+	// the other writes go through the same path
+	buf.Reset()
+	tree.CompareAndSwap("A", 1, 2)
+	tree.PutWithTTL("B", 2, time.Hour)
+	tree.PutContext(context.Background(), "C", 3)
+	tree.Apply(NewBatch[string]())
+	assert.Equal(""+
+		"level=WARN msg=\"gomapllrb: slow operation\" op=put key=A\n"+
+		"level=WARN msg=\"gomapllrb: slow operation\" op=put key=B\n"+
+		"level=WARN msg=\"gomapllrb: slow operation\" op=put key=C\n"+
+		"level=WARN msg=\"gomapllrb: slow operation\" op=apply\n", buf.String())
+	tree.Delete("B")
+	tree.Delete("C")
+
+	tree.SetLogger(logger, LogOptions{SlowOp: time.Hour})
+	buf.Reset()
+	tree.Put("B", 2)
+	assert.Empty(buf.String())
+
+	// height bound
+	tree.SetLogger(logger, LogOptions{Height: true})
+	for i := 0; i < 100; i++ {
+		tree.Put(string(rune('a'+i)), nil)
+	}
+	assert.Empty(buf.String())
+	tree.len = 2 // pretend the tree is too deep for the length
+	tree.logHeight(tree.log.Load(), "a")
+	assert.Contains(buf.String(), "level=WARN msg=\"gomapllrb: height bound exceeded\" op=put key=a depth=")
+	tree.len = 102
+
+	// check failures
+	buf.Reset()
+	tree.root.red = true
+	assert.ErrorIs(tree.Check(), ErrRootProperty)
+	assert.Equal("level=ERROR msg=\"gomapllrb: check failed\" error=\"root property violation found\" len=102\n", buf.String())
+	tree.root.red = false
+	assert.NoError(tree.Check())
+
+	// comparator panics
+	buf.Reset()
+	tree.SetCompare(func(a, b string) int {
+		if a == "bad" || b == "bad" {
+			panic("bad key")
+		}
+		return strings.Compare(a, b)
+	})
+	assert.PanicsWithValue("bad key", func() { tree.Put("bad", nil) })
+	assert.PanicsWithValue("bad key", func() { tree.Get("bad") })
+	assert.PanicsWithValue("bad key", func() {
+		tree.Compute("bad", func(old interface{}, found bool) (interface{}, bool) { return nil, true })
+	})
+	assert.Equal(""+
+		"level=ERROR msg=\"gomapllrb: operation panicked\" op=put key=bad panic=\"bad key\"\n"+
+		"level=ERROR msg=\"gomapllrb: operation panicked\" op=get key=bad panic=\"bad key\"\n"+
+		"level=ERROR msg=\"gomapllrb: operation panicked\" op=put key=bad panic=\"bad key\"\n", buf.String())
+	tree.Put("C", 3) // the lock is released
+
+	// stop logging
+	tree.SetLogger(nil, LogOptions{})
+	buf.Reset()
+	assert.Panics(func() { tree.Put("bad", nil) })
+	tree.root.red = true
+	assert.Error(tree.Check())
+	assert.Empty(buf.String())
+}
@@ -0,0 +1,118 @@
+package gomapllrb
+
+import (
+	"unsafe"
+
+	"golang.org/x/exp/constraints"
+)
+
+// MemoryUsage returns the estimated number of bytes used by the objects
+// stored. It counts the nodes, and the keys and values beyond the node if
+// the size functions are set by SetKeySize() and SetValueSize(). The usage
+// is maintained on every write, so it's cheap enough to enforce a memory
+// budget on each put. The chunks preallocated by WithArena() are not
+// counted until they are used.
+func (tree *Tree[K]) MemoryUsage() uint64 {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.mem.sum()
+}
+
+// SetKeySize sets a function returning the size of a key in bytes which is
+// not included in the node, such as the length of a string key.
+//
+//	tree.SetKeySize(func(name string) int { return len(name) })
+func (tree *Tree[K]) SetKeySize(fn func(name K) int) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.mem.keySize = fn
+	tree.mem.recount(tree.root)
+}
+
+// SetValueSize sets a function returning the size of a value in bytes.
+// The size of a value must not change while it's stored, otherwise the
+// usage drifts.
+//
+//	tree.SetValueSize(func(data interface{}) int { return len(data.([]byte)) })
+func (tree *Tree[K]) SetValueSize(fn func(data interface{}) int) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.mem.valueSize = fn
+	tree.mem.recount(tree.root)
+}
+
+/*************************************************************************
+ * Memory accounting
+ ************************************************************************/
+
+type memUsage[K constraints.Ordered] struct {
+	keySize   func(name K) int
+	valueSize func(data interface{}) int
+
+	nodes  uint64
+	keys   uint64
+	values uint64
+}
+
+func (m *memUsage[K]) sum() uint64 {
+	return m.nodes + m.keys + m.values
+}
+
+func (m *memUsage[K]) sizeOfKey(name K) uint64 {
+	if m.keySize == nil {
+		return 0
+	}
+	return uint64(m.keySize(name))
+}
+
+func (m *memUsage[K]) sizeOfValue(data interface{}) uint64 {
+	if m.valueSize == nil || data == nil {
+		return 0
+	}
+	return uint64(m.valueSize(data))
+}
+
+// put accounts a put. The old value is replaced if found.
+func (m *memUsage[K]) put(name K, old, data interface{}, found bool) {
+	if found {
+		m.values = sub(m.values, m.sizeOfValue(old))
+	} else {
+		m.nodes += uint64(unsafe.Sizeof(Node[K]{}))
+		m.keys += m.sizeOfKey(name)
+	}
+	m.values += m.sizeOfValue(data)
+}
+
+// remove accounts a deletion.
+func (m *memUsage[K]) remove(name K, data interface{}) {
+	m.nodes = sub(m.nodes, uint64(unsafe.Sizeof(Node[K]{})))
+	m.keys = sub(m.keys, m.sizeOfKey(name))
+	m.values = sub(m.values, m.sizeOfValue(data))
+}
+
+// recount counts the usage again by walking the tree.
+func (m *memUsage[K]) recount(root *Node[K]) {
+	m.reset()
+	stack := []*Node[K]{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		m.put(node.name, nil, node.data, false)
+		stack = append(stack, node.left, node.right)
+	}
+}
+
+func (m *memUsage[K]) reset() {
+	m.nodes, m.keys, m.values = 0, 0, 0
+}
+
+// sub subtracts without wrapping around.
+func sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
@@ -0,0 +1,78 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"cmp"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUsage(t *testing.T) {
+	title("Test MemoryUsage()")
+	assert := assert.New(t)
+	node := uint64(unsafe.Sizeof(Node[string]{}))
+
+	tree := New[string]()
+	assert.Equal(uint64(0), tree.MemoryUsage())
+	tree.Put("a", []byte("12345"))
+	tree.Put("bb", []byte("1"))
+	assert.Equal(2*node, tree.MemoryUsage())
+
+	// the size functions count the existing objects too
+	tree.SetKeySize(func(name string) int { return len(name) })
+	tree.SetValueSize(func(data interface{}) int { return len(data.([]byte)) })
+	assert.Equal(2*node+3+6, tree.MemoryUsage())
+
+	// update
+	tree.Put("a", []byte("1234567890"))
+	assert.Equal(2*node+3+11, tree.MemoryUsage())
+	tree.Put("ccc", nil)
+	assert.Equal(3*node+6+11, tree.MemoryUsage())
+
+	// delete
+	tree.Delete("bb")
+	tree.Delete("none")
+	assert.Equal(2*node+4+10, tree.MemoryUsage())
+
+	s := tree.Stats()
+	assert.Equal(2*node, s.Memory.Nodes)
+	assert.Equal(uint64(4), s.Memory.Keys)
+	assert.Equal(uint64(10), s.Memory.Values)
+	assert.Equal(tree.MemoryUsage(), s.Memory.Sum)
+
+	tree.Clear()
+	assert.Equal(uint64(0), tree.MemoryUsage())
+
+	// the keys equal by the comparator are counted by the one stored
+	tree.SetCompare(func(a, b string) int { return cmp.Compare(strings.TrimSpace(a), strings.TrimSpace(b)) })
+	tree.Put("abc", nil)
+	tree.Put("xyz", nil)
+	tree.Put(" xyz ", nil)
+	assert.Equal(2*node+6, tree.MemoryUsage())
+	tree.Delete(" abc ")
+	assert.Equal(node+3, tree.MemoryUsage())
+}
+
+func TestMemoryUsageEviction(t *testing.T) {
+	title("Test MemoryUsage() with eviction and expiration")
+	assert := assert.New(t)
+	node := uint64(unsafe.Sizeof(Node[int]{}))
+
+	tree := New[int](WithMaxLen(10))
+	tree.SetValueSize(func(data interface{}) int { return data.(int) })
+	for i := 1; i <= 100; i++ {
+		tree.Put(i, i)
+	}
+	// 91..100 are left
+	assert.Equal(10*node+955, tree.MemoryUsage())
+
+	// 91 is evicted, then 1000 expires
+	tree.PutWithTTL(1000, 1, 0)
+	tree.Expire()
+	assert.Equal(9, tree.Len())
+	assert.Equal(9*node+864, tree.MemoryUsage())
+}
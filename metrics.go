@@ -0,0 +1,428 @@
+package gomapllrb
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// WithMetrics enables the per-operation metrics in Stats().Ops, such as the
+// call counts and the latency histograms of the operations, the lock
+// contention and the distributions of the rotations and the flips per
+// write. It costs a few atomic updates and a clock read per call.
+func WithMetrics() Option {
+	return func(o *options) {
+		o.metrics = true
+	}
+}
+
+// HistBuckets is the number of the buckets in a Histogram.
+const HistBuckets = 48
+
+// Histogram is a distribution of the values in fixed log2 buckets. Bucket
+// 0 counts the zeros and bucket i counts the values from 2^(i-1) to 2^i-1.
+// The last bucket takes the bigger values too. The latencies are in
+// nanoseconds.
+type Histogram struct {
+	Count   uint64
+	Sum     uint64
+	Buckets [HistBuckets]uint64
+}
+
+// Mean returns the average of the values.
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return float64(h.Sum) / float64(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket where the q quantile
+// falls, such as Quantile(0.99) for p99.
+func (h Histogram) Quantile(q float64) uint64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.Count))
+	if rank >= h.Count {
+		rank = h.Count - 1
+	}
+	var n uint64
+	for i, c := range h.Buckets {
+		if n += c; n > rank {
+			return histUpper(i)
+		}
+	}
+	return histUpper(HistBuckets - 1)
+}
+
+// String returns the summary of the distribution.
+func (h Histogram) String() string {
+	return fmt.Sprintf("Count:%d, Mean:%0.2f, P50:%d, P99:%d",
+		h.Count, h.Mean(), h.Quantile(0.5), h.Quantile(0.99))
+}
+
+// OpStat is the metrics of an operation.
+type OpStat struct {
+	Count   uint64
+	Latency Histogram // including the lock wait
+}
+
+// LockStat is the metrics of acquiring a lock.
+type LockStat struct {
+	Count     uint64
+	Contended uint64    // number of times the lock was held by others
+	Wait      Histogram // wait time of the contended ones
+}
+
+// OpStats are the per-operation metrics enabled by WithMetrics().
+// Exist() is counted as Get, and EqualOrBigger() and EqualOrSmaller() as
+// Bigger and Smaller. The other writes on a key, such as CompareAndSwap(),
+// Compute(), PutWithTTL() and PutContext(), are counted as Put or Delete.
+type OpStats struct {
+	Enabled bool
+
+	Put      OpStat
+	Delete   OpStat
+	Get      OpStat
+	Min      OpStat
+	Max      OpStat
+	Bigger   OpStat
+	Smaller  OpStat
+	Iter     OpStat // Iter() calls
+	Range    OpStat // Range() calls
+	IterNext OpStat // Next() calls of the iterators
+	Apply    OpStat // Apply() calls, including Txn.Commit()
+
+	ReadLock  LockStat
+	WriteLock LockStat
+
+	Rotate Histogram // rotations per Put() and Delete()
+	Flip   Histogram // color flips per Put() and Delete()
+}
+
+/*************************************************************************
+ * Metrics functions
+ ************************************************************************/
+
+type opType int
+
+const (
+	opPut opType = iota
+	opDelete
+	opGet
+	opMin
+	opMax
+	opBigger
+	opSmaller
+	opIter
+	opRange
+	opIterNext
+	opApply
+	numOps
+)
+
+// metrics is updated atomically since the readers run concurrently. The
+// step counters are updated under the write lock.
+type metrics struct {
+	ops    [numOps]opMetric
+	rlock  lockMetric
+	wlock  lockMetric
+	rotate Histogram
+	flip   Histogram
+
+	rotates uint64 // rotations of the write in progress
+	flips   uint64 // flips of the write in progress
+}
+
+type opMetric struct {
+	count   uint64
+	latency Histogram
+}
+
+type lockMetric struct {
+	count     uint64
+	contended uint64
+	wait      Histogram
+}
+
+// timed tells if the operations need the start time, for the metrics or
+// the slow operation logs.
+func (tree *Tree[K]) timed() bool {
+	if tree.metrics != nil {
+		return true
+	}
+	l := tree.log.Load()
+	return l != nil && l.opts.SlowOp > 0
+}
+
+// rlock acquires the read lock and returns the start time of the operation
+// if it's timed.
+func (tree *Tree[K]) rlock() time.Time {
+	var start time.Time
+	if tree.timed() {
+		start = time.Now()
+	}
+	if tree.metrics == nil {
+		tree.mutex.RLock()
+		return start
+	}
+	atomic.AddUint64(&tree.metrics.rlock.count, 1)
+	if !tree.mutex.TryRLock() {
+		tree.mutex.RLock()
+		tree.metrics.rlock.contend(start)
+	}
+	return start
+}
+
+// runlock releases the read lock and records the operation. It must be
+// deferred to log the panics.
+func (tree *Tree[K]) runlock(op opType, start time.Time) {
+	tree.mutex.RUnlock()
+	if l := tree.log.Load(); l != nil {
+		if r := recover(); r != nil {
+			logPanic[K](l, op, nil, r)
+			panic(r)
+		}
+	}
+	tree.done(op, nil, start)
+}
+
+// runlockKey is same as runlock() but logs the key too.
+func (tree *Tree[K]) runlockKey(op opType, name K, start time.Time) {
+	tree.mutex.RUnlock()
+	if l := tree.log.Load(); l != nil {
+		if r := recover(); r != nil {
+			logPanic(l, op, &name, r)
+			panic(r)
+		}
+	}
+	tree.done(op, &name, start)
+}
+
+// lock acquires the write lock and returns the start time of the operation
+// if it's timed.
+func (tree *Tree[K]) lock() time.Time {
+	var start time.Time
+	if tree.timed() {
+		start = time.Now()
+	}
+	if tree.metrics == nil {
+		tree.mutex.Lock()
+		return start
+	}
+	contended := !tree.mutex.TryLock()
+	if contended {
+		tree.mutex.Lock()
+	}
+	tree.locked(start, contended)
+	return start
+}
+
+// tryLock is same as lock() but returns false without waiting if the lock
+// is held by others.
+func (tree *Tree[K]) tryLock() (time.Time, bool) {
+	var start time.Time
+	if tree.timed() {
+		start = time.Now()
+	}
+	if !tree.mutex.TryLock() {
+		return start, false
+	}
+	tree.locked(start, false)
+	return start, true
+}
+
+// locked counts the write lock acquired, and the wait since the start if
+// it was contended.
+func (tree *Tree[K]) locked(start time.Time, contended bool) {
+	m := tree.metrics
+	if m == nil {
+		return
+	}
+	atomic.AddUint64(&m.wlock.count, 1)
+	if contended {
+		m.wlock.contend(start)
+	}
+	// drop the steps of the writes not tracked, such as the expiration
+	m.rotates, m.flips = 0, 0
+}
+
+// unlock releases the write lock and records the operation on the key along
+// with its rotations and flips. It must be deferred to log the panics.
+func (tree *Tree[K]) unlock(op opType, name K, start time.Time) {
+	if m := tree.metrics; m != nil {
+		m.rotate.add(m.rotates)
+		m.flip.add(m.flips)
+		m.rotates, m.flips = 0, 0
+	}
+	tree.mutex.Unlock()
+	if l := tree.log.Load(); l != nil {
+		if r := recover(); r != nil {
+			logPanic(l, op, &name, r)
+			panic(r)
+		}
+	}
+	tree.done(op, &name, start)
+}
+
+// unlockBatch is same as unlock() but records an Apply() call, which has
+// no key. Its steps are not added to the per-write distributions.
+func (tree *Tree[K]) unlockBatch(start time.Time) {
+	if m := tree.metrics; m != nil {
+		m.rotates, m.flips = 0, 0
+	}
+	tree.mutex.Unlock()
+	if l := tree.log.Load(); l != nil {
+		if r := recover(); r != nil {
+			logPanic[K](l, opApply, nil, r)
+			panic(r)
+		}
+	}
+	tree.done(opApply, nil, start)
+}
+
+// done records the operation started at the given time.
+func (tree *Tree[K]) done(op opType, name *K, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	elapsed := time.Since(start)
+	if tree.metrics != nil {
+		tree.metrics.ops[op].record(elapsed)
+	}
+	if l := tree.log.Load(); l != nil {
+		logSlow(l, op, name, elapsed)
+	}
+}
+
+func (m *opMetric) record(elapsed time.Duration) {
+	atomic.AddUint64(&m.count, 1)
+	m.latency.add(uint64(elapsed))
+}
+
+func (m *lockMetric) contend(start time.Time) {
+	atomic.AddUint64(&m.contended, 1)
+	m.wait.add(uint64(time.Since(start)))
+}
+
+func (m *metrics) load() OpStats {
+	op := func(i opType) OpStat {
+		return OpStat{
+			Count:   atomic.LoadUint64(&m.ops[i].count),
+			Latency: m.ops[i].latency.load(),
+		}
+	}
+	lock := func(l *lockMetric) LockStat {
+		return LockStat{
+			Count:     atomic.LoadUint64(&l.count),
+			Contended: atomic.LoadUint64(&l.contended),
+			Wait:      l.wait.load(),
+		}
+	}
+	return OpStats{
+		Enabled:   true,
+		Put:       op(opPut),
+		Delete:    op(opDelete),
+		Get:       op(opGet),
+		Min:       op(opMin),
+		Max:       op(opMax),
+		Bigger:    op(opBigger),
+		Smaller:   op(opSmaller),
+		Iter:      op(opIter),
+		Range:     op(opRange),
+		IterNext:  op(opIterNext),
+		Apply:     op(opApply),
+		ReadLock:  lock(&m.rlock),
+		WriteLock: lock(&m.wlock),
+		Rotate:    m.rotate.load(),
+		Flip:      m.flip.load(),
+	}
+}
+
+func (m *metrics) reset() {
+	for i := range m.ops {
+		atomic.StoreUint64(&m.ops[i].count, 0)
+		m.ops[i].latency.reset()
+	}
+	for _, l := range []*lockMetric{&m.rlock, &m.wlock} {
+		atomic.StoreUint64(&l.count, 0)
+		atomic.StoreUint64(&l.contended, 0)
+		l.wait.reset()
+	}
+	m.rotate.reset()
+	m.flip.reset()
+}
+
+func (h *Histogram) add(v uint64) {
+	i := bits.Len64(v)
+	if i >= HistBuckets {
+		i = HistBuckets - 1
+	}
+	atomic.AddUint64(&h.Buckets[i], 1)
+	atomic.AddUint64(&h.Sum, v)
+	atomic.AddUint64(&h.Count, 1)
+}
+
+func (h *Histogram) load() Histogram {
+	var c Histogram
+	c.Count = atomic.LoadUint64(&h.Count)
+	c.Sum = atomic.LoadUint64(&h.Sum)
+	for i := range h.Buckets {
+		c.Buckets[i] = atomic.LoadUint64(&h.Buckets[i])
+	}
+	return c
+}
+
+func (h *Histogram) reset() {
+	atomic.StoreUint64(&h.Count, 0)
+	atomic.StoreUint64(&h.Sum, 0)
+	for i := range h.Buckets {
+		atomic.StoreUint64(&h.Buckets[i], 0)
+	}
+}
+
+// merge adds the counts of another distribution.
+func (h *Histogram) merge(o Histogram) {
+	h.Count += o.Count
+	h.Sum += o.Sum
+	for i, c := range o.Buckets {
+		h.Buckets[i] += c
+	}
+}
+
+// merge adds the metrics of another tree, such as a shard.
+func (s *OpStats) merge(o OpStats) {
+	if !o.Enabled {
+		return
+	}
+	s.Enabled = true
+	for _, op := range []struct{ to, from *OpStat }{
+		{&s.Put, &o.Put}, {&s.Delete, &o.Delete}, {&s.Get, &o.Get},
+		{&s.Min, &o.Min}, {&s.Max, &o.Max},
+		{&s.Bigger, &o.Bigger}, {&s.Smaller, &o.Smaller},
+		{&s.Iter, &o.Iter}, {&s.Range, &o.Range}, {&s.IterNext, &o.IterNext},
+		{&s.Apply, &o.Apply},
+	} {
+		op.to.Count += op.from.Count
+		op.to.Latency.merge(op.from.Latency)
+	}
+	for _, l := range []struct{ to, from *LockStat }{
+		{&s.ReadLock, &o.ReadLock}, {&s.WriteLock, &o.WriteLock},
+	} {
+		l.to.Count += l.from.Count
+		l.to.Contended += l.from.Contended
+		l.to.Wait.merge(l.from.Wait)
+	}
+	s.Rotate.merge(o.Rotate)
+	s.Flip.merge(o.Flip)
+}
+
+// histUpper returns the max value of the bucket.
+func histUpper(i int) uint64 {
+	if i == 0 {
+		return 0
+	}
+	return 1<<uint(i) - 1
+}
@@ -0,0 +1,134 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	title("Test Histogram")
+	assert := assert.New(t)
+
+	var h Histogram
+	assert.Equal(uint64(0), h.Quantile(0.99))
+	assert.Equal(0.0, h.Mean())
+	for _, v := range []uint64{0, 1, 2, 3, 4, 1000, 1 << 60} {
+		h.add(v)
+	}
+	assert.Equal(uint64(7), h.Count)
+	assert.Equal([]uint64{1, 1, 2, 1}, h.Buckets[:4])
+	assert.Equal(uint64(1), h.Buckets[10])
+	assert.Equal(uint64(1), h.Buckets[HistBuckets-1])
+	assert.Equal(uint64(0), h.Quantile(0))
+	assert.Equal(uint64(3), h.Quantile(0.5))
+	assert.Equal(uint64(1023), h.Quantile(0.8))
+	assert.Equal(uint64(1<<47-1), h.Quantile(1))
+	assert.Equal("Count:4, Mean:1.50, P50:3, P99:3", func() string {
+		var h Histogram
+		for _, v := range []uint64{0, 1, 2, 3} {
+			h.add(v)
+		}
+		return h.String()
+	}())
+}
+
+func TestMetrics(t *testing.T) {
+	title("Test WithMetrics()")
+	assert := assert.New(t)
+
+	// disabled by default
+	assert.False(New[int]().Stats().Ops.Enabled)
+
+	tree := New[int](WithMetrics())
+	tree.ResetStats()
+	for i := 0; i < 100; i++ {
+		tree.Put(i, i)
+	}
+	for i := 0; i < 10; i++ {
+		tree.Get(i)
+		tree.Exist(i)
+		tree.Delete(i)
+	}
+	tree.Min()
+	tree.Max()
+	tree.Bigger(50)
+	tree.EqualOrBigger(50)
+	tree.Smaller(50)
+	for it := tree.Range(20, 29); it.Next(); {
+	}
+	it := tree.Iter()
+	it.Next()
+
+	s := tree.Stats()
+	ops := s.Ops
+	assert.True(ops.Enabled)
+	assert.Equal(uint64(100), ops.Put.Count)
+	assert.Equal(uint64(100), ops.Put.Latency.Count)
+	assert.Equal(uint64(10), ops.Delete.Count)
+	assert.Equal(uint64(20), ops.Get.Count)
+	assert.Equal(uint64(1), ops.Min.Count)
+	assert.Equal(uint64(1), ops.Max.Count)
+	assert.Equal(uint64(2), ops.Bigger.Count)
+	assert.Equal(uint64(1), ops.Smaller.Count)
+	assert.Equal(uint64(1), ops.Range.Count)
+	assert.Equal(uint64(1), ops.Iter.Count)
+	assert.Equal(uint64(10+1+1), ops.IterNext.Count)
+	assert.Equal(uint64(110), ops.WriteLock.Count)
+	assert.Equal(uint64(20+1+1+3+1+1+12), ops.ReadLock.Count)
+	assert.Equal(uint64(0), ops.WriteLock.Contended)
+
+	// the distributions of the steps per write
+	assert.Equal(uint64(110), ops.Rotate.Count)
+	assert.Equal(s.Perf.Rotate.Sum, ops.Rotate.Sum)
+	assert.Equal(s.Perf.Flip, ops.Flip.Sum)
+
+	// lock contention
+	tree.mutex.Lock()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	started := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		close(started)
+		tree.Get(50)
+	}()
+	<-started
+	time.Sleep(10 * time.Millisecond)
+	tree.mutex.Unlock()
+	wg.Wait()
+	ops = tree.Stats().Ops
+	// the goroutine may be scheduled a bit late after started
+	assert.Equal(uint64(1), ops.ReadLock.Contended)
+	assert.LessOrEqual(uint64(5*time.Millisecond), ops.ReadLock.Wait.Sum)
+	assert.LessOrEqual(uint64(5*time.Millisecond), ops.Get.Latency.Quantile(1))
+
+	// the other writes
+	tree.ResetStats()
+	tree.CompareAndSwap(50, 50, 0)
+	tree.Compute(51, func(old interface{}, found bool) (interface{}, bool) { return nil, false })
+	tree.PutWithTTL(52, 52, time.Hour)
+	tree.TryPut(53, 53)
+	tree.DeleteContext(context.Background(), 54)
+	b := NewBatch[int]()
+	b.Put(1, 1)
+	b.Delete(55)
+	tree.Apply(b)
+	ops = tree.Stats().Ops
+	assert.Equal(uint64(4), ops.Put.Count)
+	assert.Equal(uint64(1), ops.Delete.Count)
+	assert.Equal(uint64(1), ops.Apply.Count)
+	assert.Equal(uint64(6), ops.WriteLock.Count)
+	assert.Equal(uint64(5), ops.Rotate.Count)
+
+	tree.ResetStats()
+	ops = tree.Stats().Ops
+	assert.True(ops.Enabled)
+	assert.Equal(uint64(0), ops.Get.Count)
+	assert.Equal(uint64(0), ops.ReadLock.Wait.Count)
+}
@@ -0,0 +1,174 @@
+package gomapllrb
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"unicode/utf8"
+
+	"golang.org/x/exp/constraints"
+)
+
+// The operations in the logs.
+const (
+	OpLogPut    = "put"
+	OpLogDelete = "delete"
+	OpLogClear  = "clear"
+)
+
+// OpRecord is a mutating operation in the logs written by OpRecorder.
+type OpRecord[K constraints.Ordered] struct {
+	Op    string      // one of OpLogPut, OpLogDelete and OpLogClear
+	Key   K           // zero for OpLogClear
+	Value interface{} // nil unless the values are recorded
+}
+
+// OpRecorder writes the mutating operations of a tree to a log in JSON
+// lines, one operation per line. Set it to a tree by SetRecorder().
+//
+//	{"op":"put","key":"A","value":1}
+//	{"op":"delete","key":"A"}
+//
+// The string keys which aren't valid UTF-8 are written in base64 as
+// key_raw, since JSON would replace the invalid bytes.
+//
+//	{"op":"put","key_raw":"/w==","value":1}
+//
+// The deletions by expiration and eviction are recorded as deletes, and
+// so are the deletes of the keys not found, since they change the tree
+// structure too. So replaying the log to a tree without TTLs and eviction
+// reproduces the same tree structure.
+type OpRecorder[K constraints.Ordered] struct {
+	enc    *json.Encoder
+	values bool
+	err    error
+}
+
+// opLine is a line of the logs.
+type opLine[K constraints.Ordered] struct {
+	Op     string      `json:"op"`
+	Key    *K          `json:"key,omitempty"`
+	KeyRaw []byte      `json:"key_raw,omitempty"` // string keys not in UTF-8
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// NewOpRecorder creates a recorder writing to w. The values are recorded
+// too if values is true, which must be encodable in JSON. Buffer w if it's
+// slow since it's written under the write lock of the tree.
+func NewOpRecorder[K constraints.Ordered](w io.Writer, values bool) *OpRecorder[K] {
+	return &OpRecorder[K]{enc: json.NewEncoder(w), values: values}
+}
+
+// Err returns the first error of writing the log. The recorder stops
+// writing on error, while the tree keeps applying the changes. The error
+// is logged by the logger set by SetLogger() when it happens.
+func (r *OpRecorder[K]) Err() error {
+	return r.err
+}
+
+// SetRecorder starts recording the mutating operations to the recorder.
+// A recorder is for a tree. Set nil to stop recording.
+func (tree *Tree[K]) SetRecorder(r *OpRecorder[K]) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.oplog = r
+}
+
+// Replay applies the operations in the log to the tree in order.
+func Replay[K constraints.Ordered](r io.Reader, tree *Tree[K]) error {
+	return ReplayFunc(r, tree, nil)
+}
+
+// ReplayFunc is same as Replay() but calls fn after each step, starting
+// from step 1. It stops when fn returns an error. The errors are returned
+// with the step.
+//
+//	err := ReplayFunc(f, tree, func(step int, rec OpRecord[string]) error {
+//	  return tree.Check()
+//	})
+func ReplayFunc[K constraints.Ordered](r io.Reader, tree *Tree[K], fn func(step int, rec OpRecord[K]) error) error {
+	_, err := replay(r, tree, fn)
+	return err
+}
+
+/*************************************************************************
+ * Recording functions
+ ************************************************************************/
+
+// replay applies the log and returns the offset of the end of the last
+// operation applied.
+func replay[K constraints.Ordered](r io.Reader, tree *Tree[K], fn func(step int, rec OpRecord[K]) error) (int64, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var offset int64
+	for step := 1; ; step++ {
+		var line opLine[K]
+		if err := dec.Decode(&line); err == io.EOF {
+			return offset, nil
+		} else if err != nil {
+			return offset, fmt.Errorf("step %d: %w", step, err)
+		}
+
+		rec := OpRecord[K]{Op: line.Op, Value: line.Value}
+		if line.Key != nil {
+			rec.Key = *line.Key
+		} else if line.KeyRaw != nil {
+			if v := reflect.ValueOf(&rec.Key).Elem(); v.Kind() == reflect.String {
+				v.SetString(string(line.KeyRaw))
+			} else {
+				return offset, fmt.Errorf("step %d: key_raw for a non-string key", step)
+			}
+		} else if line.Op != OpLogClear {
+			return offset, fmt.Errorf("step %d: key missing", step)
+		}
+		switch rec.Op {
+		case OpLogPut:
+			tree.Put(rec.Key, rec.Value)
+		case OpLogDelete:
+			tree.Delete(rec.Key)
+		case OpLogClear:
+			tree.Clear()
+		default:
+			return offset, fmt.Errorf("step %d: unknown operation %q", step, rec.Op)
+		}
+		offset = dec.InputOffset()
+		if fn != nil {
+			if err := fn(step, rec); err != nil {
+				return offset, fmt.Errorf("step %d: %w", step, err)
+			}
+		}
+	}
+}
+
+// record writes an operation to the recorder of the tree and logs the
+// error which stops the recording. The caller must hold the write lock.
+func (tree *Tree[K]) record(op string, name K, data interface{}) {
+	r := tree.oplog
+	if r.err != nil {
+		return
+	}
+	r.record(op, name, data)
+	if r.err != nil {
+		tree.logRecord(op, name, r.err)
+	}
+}
+
+// record writes an operation. The caller must hold the write lock.
+func (r *OpRecorder[K]) record(op string, name K, data interface{}) {
+	if r.err != nil {
+		return
+	}
+	line := opLine[K]{Op: op}
+	if op != OpLogClear {
+		if v := reflect.ValueOf(name); v.Kind() == reflect.String && !utf8.ValidString(v.String()) {
+			line.KeyRaw = []byte(v.String())
+		} else {
+			line.Key = &name
+		}
+	}
+	if r.values {
+		line.Value = data
+	}
+	r.err = r.enc.Encode(line)
+}
@@ -0,0 +1,111 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpRecorder(t *testing.T) {
+	title("Test OpRecorder and Replay()")
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	rec := NewOpRecorder[int](&buf, true)
+	tree := New[int](WithMaxLen(300))
+	tree.SetRecorder(rec)
+	for i := 0; i < 2000; i++ {
+		k := int(hash32(i) % 1000)
+		if i%3 == 0 {
+			tree.Delete(k)
+		} else {
+			tree.Put(k, fmt.Sprint(i))
+		}
+		if i == 1000 {
+			tree.Clear()
+		}
+	}
+	assert.NoError(rec.Err())
+	assert.True(strings.HasPrefix(buf.String(), ""+
+		`{"op":"delete","key":`+fmt.Sprint(hash32(0)%1000)+"}\n"+
+		`{"op":"put","key":`+fmt.Sprint(hash32(1)%1000)+`,"value":"1"}`+"\n"))
+	assert.Contains(buf.String(), `{"op":"clear"}`+"\n")
+
+	// the same structure including the evictions
+	replayed := New[int]()
+	steps := 0
+	assert.NoError(ReplayFunc(bytes.NewReader(buf.Bytes()), replayed, func(step int, rec OpRecord[int]) error {
+		steps = step
+		return nil
+	}))
+	assert.Equal(strings.Count(buf.String(), "\n"), steps)
+	assert.Equal(tree.String(), replayed.String())
+	assert.Equal(tree.Map(), replayed.Map())
+
+	// without the values
+	buf.Reset()
+	tree.SetRecorder(NewOpRecorder[int](&buf, false))
+	tree.Put(1, "one")
+	tree.SetRecorder(nil)
+	tree.Put(2, "two")
+	assert.Equal(`{"op":"put","key":1}`+"\n", buf.String())
+
+	// the string keys not in UTF-8
+	buf.Reset()
+	strs := New[string]()
+	strs.SetRecorder(NewOpRecorder[string](&buf, false))
+	strs.Put("\xff", nil)
+	strs.Put("\xfe", nil)
+	strs.Put("A", nil)
+	strs.Delete("\xfe")
+	assert.Equal(`{"op":"put","key_raw":"/w=="}`+"\n"+
+		`{"op":"put","key_raw":"/g=="}`+"\n"+
+		`{"op":"put","key":"A"}`+"\n"+
+		`{"op":"delete","key_raw":"/g=="}`+"\n", buf.String())
+	replayedStrs := New[string]()
+	assert.NoError(Replay(bytes.NewReader(buf.Bytes()), replayedStrs))
+	assert.Equal(map[string]interface{}{"A": nil, "\xff": nil}, replayedStrs.Map())
+
+	// the errors with the step
+	for _, c := range []struct {
+		log string
+		err string
+	}{
+		{`{"op":"put","key":1}` + "\n" + `{"op":"put","key":` + "\n", "step 2: unexpected EOF"},
+		{`{"op":"put","key":"A"}`, "step 1: json: cannot unmarshal string into Go struct field opLine[int].key of type int"},
+		{`{"op":"put"}`, "step 1: key missing"},
+		{`{"op":"put","key_raw":"AQ=="}`, "step 1: key_raw for a non-string key"},
+		{`{"op":"get","key":1}`, `step 1: unknown operation "get"`},
+	} {
+		assert.EqualError(Replay(strings.NewReader(c.log), New[int]()), c.err)
+	}
+	failed := errors.New("failed")
+	err := ReplayFunc(strings.NewReader(`{"op":"put","key":1}{"op":"delete","key":1}`), New[int](),
+		func(step int, rec OpRecord[int]) error {
+			if rec.Op == OpLogDelete {
+				return failed
+			}
+			return nil
+		})
+	assert.ErrorIs(err, failed)
+	assert.EqualError(err, "step 2: failed")
+
+	// stops on the write error
+	rec = NewOpRecorder[int](errWriter{}, true)
+	tree.SetRecorder(rec)
+	tree.Put(3, "three")
+	tree.Put(4, func() {})
+	assert.EqualError(rec.Err(), "write failed")
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
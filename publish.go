@@ -0,0 +1,243 @@
+package gomapllrb
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PublishExpvar names the tree and publishes its length and Stats() as an
+// expvar variable of the name, which is served at /debug/vars. The named
+// trees are also exported by WriteMetrics() and MetricsHandler().
+//
+// Publishing another tree with the same name replaces the old one. The
+// trees published are kept for the life of the process like the expvar
+// variables are. It panics if the name is taken by another expvar variable.
+func (tree *Tree[K]) PublishExpvar(name string) {
+	publish(name, tree)
+}
+
+// PublishExpvar is the same as Tree.PublishExpvar().
+func (tree *CompactTree[K]) PublishExpvar(name string) {
+	publish(name, tree)
+}
+
+// PublishExpvar is the same as Tree.PublishExpvar().
+func (st *ShardedTree[K]) PublishExpvar(name string) {
+	publish(name, st)
+}
+
+// WriteMetrics writes the metrics of the trees named by PublishExpvar() in
+// the Prometheus text exposition format. The series are labeled with the
+// tree names. The rotation and flip counters are shared by all the trees,
+// so they have no label. The histograms are written for the trees with
+// WithMetrics() enabled.
+//
+//	gomapllrb_len{tree="users"} 1000
+//	gomapllrb_put_total{tree="users",result="new"} 1000
+func WriteMetrics(w io.Writer) error {
+	var buf bytes.Buffer
+	writeMetrics(&buf, published())
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// MetricsHandler returns an HTTP handler serving WriteMetrics().
+//
+//	http.Handle("/metrics", gomapllrb.MetricsHandler())
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w)
+	})
+}
+
+/*************************************************************************
+ * Publishing functions
+ ************************************************************************/
+
+// statsSource is a tree to publish.
+type statsSource interface {
+	Len() int
+	Stats() Stats
+}
+
+// expvarStats is the value of the expvar variables.
+type expvarStats struct {
+	Len   int
+	Stats Stats
+}
+
+// publishedTree is a snapshot of a named tree.
+type publishedTree struct {
+	name  string
+	len   int
+	stats Stats
+}
+
+var registry = struct {
+	sync.Mutex
+	trees map[string]statsSource
+}{trees: map[string]statsSource{}}
+
+func publish(name string, src statsSource) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, found := registry.trees[name]; !found {
+		expvar.Publish(name, expvar.Func(func() interface{} {
+			registry.Lock()
+			src := registry.trees[name]
+			registry.Unlock()
+			return expvarStats{Len: src.Len(), Stats: src.Stats()}
+		}))
+	}
+	registry.trees[name] = src
+}
+
+// published returns the snapshots of the named trees in the name order.
+func published() []publishedTree {
+	registry.Lock()
+	names := make([]string, 0, len(registry.trees))
+	for name := range registry.trees {
+		names = append(names, name)
+	}
+	srcs := make([]statsSource, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		srcs[i] = registry.trees[name]
+	}
+	registry.Unlock()
+
+	trees := make([]publishedTree, len(names))
+	for i, src := range srcs {
+		trees[i] = publishedTree{name: names[i], len: src.Len(), stats: src.Stats()}
+	}
+	return trees
+}
+
+func writeMetrics(buf *bytes.Buffer, trees []publishedTree) {
+	family := func(name, typ, help string) {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	series := func(name string, t publishedTree, labels string, v uint64) {
+		fmt.Fprintf(buf, "%s{tree=\"%s\"%s} %d\n", name, promEscape(t.name), labels, v)
+	}
+
+	family("gomapllrb_len", "gauge", "Number of the keys stored.")
+	for _, t := range trees {
+		series("gomapllrb_len", t, "", uint64(t.len))
+	}
+	family("gomapllrb_put_total", "counter", "Number of the puts by the result.")
+	for _, t := range trees {
+		series("gomapllrb_put_total", t, `,result="new"`, t.stats.Put.New)
+		series("gomapllrb_put_total", t, `,result="update"`, t.stats.Put.Update)
+	}
+	family("gomapllrb_get_total", "counter", "Number of the gets by the result.")
+	for _, t := range trees {
+		series("gomapllrb_get_total", t, `,result="found"`, t.stats.Get.Found)
+		series("gomapllrb_get_total", t, `,result="not_found"`, t.stats.Get.NotFound)
+	}
+	family("gomapllrb_delete_total", "counter", "Number of the deletes by the result.")
+	for _, t := range trees {
+		series("gomapllrb_delete_total", t, `,result="deleted"`, t.stats.Delete.Deleted)
+		series("gomapllrb_delete_total", t, `,result="not_found"`, t.stats.Delete.NotFound)
+	}
+	family("gomapllrb_expired_total", "counter", "Number of the keys expired.")
+	for _, t := range trees {
+		series("gomapllrb_expired_total", t, "", t.stats.Expired)
+	}
+	family("gomapllrb_evicted_total", "counter", "Number of the keys evicted.")
+	for _, t := range trees {
+		series("gomapllrb_evicted_total", t, "", t.stats.Evicted)
+	}
+	family("gomapllrb_memory_bytes", "gauge", "Estimated memory usage by the kind.")
+	for _, t := range trees {
+		series("gomapllrb_memory_bytes", t, `,kind="nodes"`, t.stats.Memory.Nodes)
+		series("gomapllrb_memory_bytes", t, `,kind="keys"`, t.stats.Memory.Keys)
+		series("gomapllrb_memory_bytes", t, `,kind="values"`, t.stats.Memory.Values)
+	}
+
+	// shared by all the trees
+	family("gomapllrb_rotate_total", "counter", "Number of the rotations of all the trees.")
+	perf := loadPerf()
+	fmt.Fprintf(buf, "gomapllrb_rotate_total{direction=\"left\"} %d\n", perf.Rotate.Left)
+	fmt.Fprintf(buf, "gomapllrb_rotate_total{direction=\"right\"} %d\n", perf.Rotate.Right)
+	family("gomapllrb_flip_total", "counter", "Number of the color flips of all the trees.")
+	fmt.Fprintf(buf, "gomapllrb_flip_total %d\n", perf.Flip)
+
+	// the trees with the per-operation metrics
+	var ops []publishedTree
+	for _, t := range trees {
+		if t.stats.Ops.Enabled {
+			ops = append(ops, t)
+		}
+	}
+	if len(ops) == 0 {
+		return
+	}
+	family("gomapllrb_op_duration_seconds", "histogram", "Latency of the operations including the lock wait.")
+	for _, t := range ops {
+		o := t.stats.Ops
+		for _, op := range []struct {
+			name string
+			stat OpStat
+		}{
+			{"put", o.Put}, {"delete", o.Delete}, {"get", o.Get},
+			{"min", o.Min}, {"max", o.Max}, {"bigger", o.Bigger}, {"smaller", o.Smaller},
+			{"iter", o.Iter}, {"range", o.Range}, {"iter_next", o.IterNext},
+			{"apply", o.Apply},
+		} {
+			writeHistogram(buf, "gomapllrb_op_duration_seconds", t.name, `,op="`+op.name+`"`, op.stat.Latency, 1e-9)
+		}
+	}
+	family("gomapllrb_lock_total", "counter", "Number of the lock acquisitions by the lock type.")
+	for _, t := range ops {
+		series("gomapllrb_lock_total", t, `,lock="read"`, t.stats.Ops.ReadLock.Count)
+		series("gomapllrb_lock_total", t, `,lock="write"`, t.stats.Ops.WriteLock.Count)
+	}
+	family("gomapllrb_lock_contended_total", "counter", "Number of the lock acquisitions which had to wait.")
+	for _, t := range ops {
+		series("gomapllrb_lock_contended_total", t, `,lock="read"`, t.stats.Ops.ReadLock.Contended)
+		series("gomapllrb_lock_contended_total", t, `,lock="write"`, t.stats.Ops.WriteLock.Contended)
+	}
+	family("gomapllrb_lock_wait_seconds", "histogram", "Wait time of the contended lock acquisitions.")
+	for _, t := range ops {
+		writeHistogram(buf, "gomapllrb_lock_wait_seconds", t.name, `,lock="read"`, t.stats.Ops.ReadLock.Wait, 1e-9)
+		writeHistogram(buf, "gomapllrb_lock_wait_seconds", t.name, `,lock="write"`, t.stats.Ops.WriteLock.Wait, 1e-9)
+	}
+	family("gomapllrb_write_rotations", "histogram", "Number of the rotations per put and delete.")
+	for _, t := range ops {
+		writeHistogram(buf, "gomapllrb_write_rotations", t.name, "", t.stats.Ops.Rotate, 1)
+	}
+	family("gomapllrb_write_flips", "histogram", "Number of the color flips per put and delete.")
+	for _, t := range ops {
+		writeHistogram(buf, "gomapllrb_write_flips", t.name, "", t.stats.Ops.Flip, 1)
+	}
+}
+
+// writeHistogram writes the cumulative buckets of the histogram. The values
+// are multiplied by the scale, such as 1e-9 for the nanoseconds.
+func writeHistogram(buf *bytes.Buffer, name, tree, labels string, h Histogram, scale float64) {
+	labels = `tree="` + promEscape(tree) + `"` + labels
+	var n uint64
+	for i := 0; i < HistBuckets-1; i++ {
+		n += h.Buckets[i]
+		le := strconv.FormatFloat(float64(histUpper(i))*scale, 'g', -1, 64)
+		fmt.Fprintf(buf, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, le, n)
+	}
+	// counted from the buckets to be consistent with them under updates
+	n += h.Buckets[HistBuckets-1]
+	fmt.Fprintf(buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, n)
+	fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(float64(h.Sum)*scale, 'g', -1, 64))
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, n)
+}
+
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,104 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	title("Test PublishExpvar()")
+	assert := assert.New(t)
+
+	tree := New[string]()
+	tree.PublishExpvar("gomapllrb_test_expvar")
+	tree.Put("A", 1)
+	tree.Put("B", 2)
+	tree.Get("A")
+
+	var v struct {
+		Len   int
+		Stats Stats
+	}
+	assert.NoError(json.Unmarshal([]byte(expvar.Get("gomapllrb_test_expvar").String()), &v))
+	assert.Equal(2, v.Len)
+	assert.Equal(uint64(2), v.Stats.Put.New)
+	assert.Equal(uint64(1), v.Stats.Get.Found)
+
+	// replaced by the same name
+	other := New[int]()
+	other.PublishExpvar("gomapllrb_test_expvar")
+	assert.NoError(json.Unmarshal([]byte(expvar.Get("gomapllrb_test_expvar").String()), &v))
+	assert.Equal(0, v.Len)
+}
+
+func TestWriteMetrics(t *testing.T) {
+	title("Test WriteMetrics() and MetricsHandler()")
+	assert := assert.New(t)
+
+	tree := New[string](WithMetrics())
+	tree.PublishExpvar(`gomapllrb_test_"metrics"`)
+	tree.Put("A", 1)
+	tree.Put("A", 2)
+	tree.Put("B", 3)
+	tree.Get("A")
+	tree.Get("C")
+	tree.Delete("C")
+	sharded := NewSharded([]int{100})
+	sharded.PublishExpvar("gomapllrb_test_sharded")
+	sharded.Put(1, nil)
+
+	var buf bytes.Buffer
+	assert.NoError(WriteMetrics(&buf))
+	out := buf.String()
+	for _, line := range []string{
+		"# HELP gomapllrb_len Number of the keys stored.\n# TYPE gomapllrb_len gauge\n",
+		`gomapllrb_len{tree="gomapllrb_test_\"metrics\""} 2` + "\n",
+		`gomapllrb_len{tree="gomapllrb_test_sharded"} 1` + "\n",
+		`gomapllrb_put_total{tree="gomapllrb_test_\"metrics\"",result="new"} 2` + "\n",
+		`gomapllrb_put_total{tree="gomapllrb_test_\"metrics\"",result="update"} 1` + "\n",
+		`gomapllrb_get_total{tree="gomapllrb_test_\"metrics\"",result="found"} 1` + "\n",
+		`gomapllrb_get_total{tree="gomapllrb_test_\"metrics\"",result="not_found"} 1` + "\n",
+		`gomapllrb_delete_total{tree="gomapllrb_test_\"metrics\"",result="not_found"} 1` + "\n",
+		"# TYPE gomapllrb_rotate_total counter\ngomapllrb_rotate_total{direction=\"left\"} ",
+		"# TYPE gomapllrb_flip_total counter\ngomapllrb_flip_total ",
+		`gomapllrb_op_duration_seconds_bucket{tree="gomapllrb_test_\"metrics\"",op="put",le="+Inf"} 3` + "\n",
+		`gomapllrb_op_duration_seconds_count{tree="gomapllrb_test_\"metrics\"",op="get"} 2` + "\n",
+		`gomapllrb_lock_total{tree="gomapllrb_test_\"metrics\"",lock="write"} 4` + "\n",
+		`gomapllrb_write_rotations_bucket{tree="gomapllrb_test_\"metrics\"",le="0"} `,
+		`gomapllrb_write_rotations_count{tree="gomapllrb_test_\"metrics\""} 4` + "\n",
+	} {
+		assert.Contains(out, line)
+	}
+	// the histograms only for the trees with the metrics enabled
+	assert.NotContains(out, `gomapllrb_op_duration_seconds_count{tree="gomapllrb_test_sharded"`)
+	assert.Equal(1, strings.Count(out, "# TYPE gomapllrb_op_duration_seconds histogram\n"))
+
+	// served over HTTP
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(200, rec.Code)
+	assert.Equal("text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body, _ := io.ReadAll(rec.Body)
+	assert.Contains(string(body), `gomapllrb_len{tree="gomapllrb_test_sharded"} 1`)
+
+	// a reset of the tree keeps the shared counters monotonic
+	perf := loadPerf()
+	tree.ResetStats()
+	assert.Equal(perf, loadPerf())
+	assert.Equal(PerfStats{}, tree.Stats().Perf)
+	for i := 0; i < 10; i++ {
+		tree.Put(fmt.Sprint(i), i)
+	}
+	assert.Less(perf.Rotate.Sum, loadPerf().Rotate.Sum)
+	assert.Equal(loadPerf().Rotate.Sum-perf.Rotate.Sum, tree.Stats().Perf.Rotate.Sum)
+}
@@ -0,0 +1,199 @@
+package gomapllrb
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Render returns a drawing of the tree structure like String() does, with
+// the options. Render(ViewOptions[K]{}) is the same as String().
+//
+// MaxDepth and MaxNodes elide the rest with "..." markers. The nodes are
+// taken level by level, so MaxNodes keeps the top of the tree.
+//
+// Grouped draws the 2-3-4 tree (or the 2-3 tree for the 2-3 variant) the
+// LLRB represents, by merging the red nodes into their black parents.
+//
+//	    ┌───(S X)
+//	┌───(R)
+//	│   └───(I N)
+//	(E)
+//	│   ┌───(D)
+//	└───(C)
+//	    └───(A B)
+func (tree *Tree[K]) Render(opts ViewOptions[K]) string {
+	tree.mutex.RLock()
+	top := tree.renderTree(opts)
+	tree.mutex.RUnlock()
+
+	var buf bytes.Buffer
+	printRender(top, &buf)
+	return buf.String()
+}
+
+/*************************************************************************
+ * Rendering functions
+ ************************************************************************/
+
+// renderObj is a node to render, which can be a group of nodes in the
+// grouped view. The children keep the positions with nil entries.
+type renderObj struct {
+	label    string
+	red      bool
+	more     bool // marker of the elided subtrees
+	children []*renderObj
+}
+
+// renderTree builds the nodes to render level by level.
+func (tree *Tree[K]) renderTree(opts ViewOptions[K]) *renderObj {
+	top := tree.viewTop(opts)
+	if top == nil {
+		return nil
+	}
+
+	type queueObj struct {
+		node  *Node[K]
+		depth int
+		slot  **renderObj
+	}
+	var root *renderObj
+	queue := []queueObj{{node: top, slot: &root}}
+	num := 0
+	for len(queue) > 0 {
+		q := queue[0]
+		queue = queue[1:]
+		if (opts.MaxDepth > 0 && q.depth >= opts.MaxDepth) ||
+			(opts.MaxNodes > 0 && num >= opts.MaxNodes) {
+			*q.slot = &renderObj{label: "...", more: true}
+			continue
+		}
+		num++
+
+		members, children := tree.renderGroup(q.node, opts)
+		obj := &renderObj{
+			red:      !opts.Grouped && q.node.red,
+			children: make([]*renderObj, len(children)),
+		}
+		labels := make([]string, len(members))
+		for i, node := range members {
+			labels[i] = viewLabel(node, opts.Values, "=")
+		}
+		obj.label = strings.Join(labels, " ")
+		if opts.Grouped {
+			obj.label = "(" + obj.label + ")"
+		}
+		*q.slot = obj
+
+		for i, child := range children {
+			if child != nil && (!opts.Span || tree.inSpan(child, opts)) {
+				queue = append(queue, queueObj{node: child, depth: q.depth + 1, slot: &obj.children[i]})
+			}
+		}
+	}
+	return root
+}
+
+// renderGroup returns the nodes rendered together and their children in
+// order. It's the node itself unless grouped.
+func (tree *Tree[K]) renderGroup(node *Node[K], opts ViewOptions[K]) ([]*Node[K], []*Node[K]) {
+	if !opts.Grouped {
+		return []*Node[K]{node}, []*Node[K]{node.left, node.right}
+	}
+	var members, children []*Node[K]
+	if isRed(node.left) {
+		members = append(members, node.left)
+		children = append(children, node.left.left, node.left.right)
+	} else {
+		children = append(children, node.left)
+	}
+	members = append(members, node)
+	if isRed(node.right) {
+		members = append(members, node.right)
+		children = append(children, node.right.left, node.right.right)
+	} else {
+		children = append(children, node.right)
+	}
+	return members, children
+}
+
+// printRender prints the nodes sideways, the bigger children on top, like
+// printNode() but for any number of children.
+func printRender(root *renderObj, out *bytes.Buffer) {
+	type lineObj struct {
+		obj       *renderObj
+		prefix    string // printed before the connector
+		connector string
+		up, down  string // extensions of the prefix for the children
+		print     bool   // print the line or expand the children
+	}
+
+	stack := []lineObj{{obj: root}}
+	for len(stack) > 0 {
+		line := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if line.obj == nil {
+			continue
+		}
+
+		obj := line.obj
+		if line.print {
+			out.WriteString(line.prefix)
+			out.WriteString(line.connector)
+			if line.connector != "" {
+				if obj.red {
+					out.WriteString("[")
+				} else {
+					out.WriteString("─")
+				}
+			} else if obj.red {
+				out.WriteString("[")
+			}
+			out.WriteString(obj.label)
+			if obj.red {
+				out.WriteString("]\n")
+			} else {
+				out.WriteString(" \n")
+			}
+			continue
+		}
+
+		// the upper half of the children is printed above the node
+		half := len(obj.children) / 2
+		first, last := -1, -1 // the top and the bottom children
+		for i := len(obj.children) - 1; i >= half; i-- {
+			if obj.children[i] != nil {
+				first = i
+				break
+			}
+		}
+		for i := 0; i < half; i++ {
+			if obj.children[i] != nil {
+				last = i
+				break
+			}
+		}
+
+		// push in the reverse order of printing
+		for i, child := range obj.children {
+			if i == half {
+				stack = append(stack, lineObj{obj: obj, prefix: line.prefix, connector: line.connector, print: true})
+			}
+			c := lineObj{obj: child, up: "│   ", down: "│   "}
+			if i < half {
+				c.prefix, c.connector = line.prefix+line.down, "├──"
+				if i == last {
+					c.connector, c.down = "└──", "    "
+				}
+			} else {
+				c.prefix, c.connector = line.prefix+line.up, "├──"
+				if i == first {
+					c.connector, c.up = "┌──", "    "
+				}
+			}
+			stack = append(stack, c)
+		}
+		if half == len(obj.children) {
+			stack = append(stack, lineObj{obj: obj, prefix: line.prefix, connector: line.connector, print: true})
+		}
+	}
+}
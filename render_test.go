@@ -0,0 +1,84 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	title("Test Render()")
+	assert := assert.New(t)
+
+	tree := New[string]()
+	assert.Equal("", tree.Render(ViewOptions[string]{}))
+	for _, k := range []string{"A", "S", "E", "R", "C", "D", "I", "N", "B", "X"} {
+		tree.Put(k, k+k)
+	}
+	assert.Equal(tree.String(), tree.Render(ViewOptions[string]{}))
+	if !LLRB234 {
+		return
+	}
+
+	// the 2-3-4 tree in the slides
+	assert.Equal(""+
+		"    ┌───(S X) \n"+
+		"┌───(R) \n"+
+		"│   └───(I N) \n"+
+		"(E) \n"+
+		"│   ┌───(D) \n"+
+		"└───(C) \n"+
+		"    └───(A B) \n", tree.Render(ViewOptions[string]{Grouped: true}))
+
+	// values and the node limit
+	assert.Equal(""+
+		"    ┌───... \n"+
+		"┌───R=RR \n"+
+		"│   └───... \n"+
+		"E=EE \n"+
+		"│   ┌───... \n"+
+		"└───C=CC \n"+
+		"    └───B=BB \n"+
+		"        └───... \n", tree.Render(ViewOptions[string]{Values: true, MaxNodes: 4}))
+
+	// depth limit
+	assert.Equal(""+
+		"    ┌───... \n"+
+		"┌───(R) \n"+
+		"│   └───... \n"+
+		"(E) \n"+
+		"│   ┌───... \n"+
+		"└───(C) \n"+
+		"    └───... \n", tree.Render(ViewOptions[string]{Grouped: true, MaxDepth: 2}))
+
+	// key range
+	assert.Equal(""+
+		"┌───X \n"+
+		"│   └──[S]\n"+
+		"R \n"+
+		"└───N \n", tree.Render(ViewOptions[string]{Span: true, Start: "M", End: "T"}))
+
+	// 4-nodes
+	numbers := New[int]()
+	for i := 1; i <= 12; i++ {
+		numbers.Put(i, nil)
+	}
+	assert.Equal(""+
+		"    ┌───(11 12) \n"+
+		"    ├───(9) \n"+
+		"┌───(6 8 10) \n"+
+		"│   ├───(7) \n"+
+		"│   └───(5) \n"+
+		"(4) \n"+
+		"│   ┌───(3) \n"+
+		"└───(2) \n"+
+		"    └───(1) \n", numbers.Render(ViewOptions[int]{Grouped: true}))
+
+	// same as String() for a big tree
+	for i := 0; i < 1000; i++ {
+		numbers.Put(int(hash32(i)%3000), nil)
+	}
+	assert.Equal(numbers.String(), numbers.Render(ViewOptions[int]{}))
+}
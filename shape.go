@@ -0,0 +1,94 @@
+package gomapllrb
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"golang.org/x/exp/constraints"
+)
+
+// Shape is the structural metrics of the tree returned by Shape().
+// The depth of the root is 0.
+type Shape struct {
+	Len         int     // number of nodes
+	Height      int     // number of levels, 0 for empty tree
+	BlackHeight int     // number of black nodes on the left-most path
+	Red         int     // number of red nodes
+	Black       int     // number of black nodes
+	MaxDepth    int     // depth of the deepest node
+	AvgDepth    float64 // average depth of the nodes
+	Depths      []int   // histogram, the number of nodes at each depth
+}
+
+// Shape returns the structural metrics of the tree, computed in one pass.
+func (tree *Tree[K]) Shape() Shape {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	shape, _ := shapeOf(context.Background(), tree.root)
+	return shape
+}
+
+// String returns the metrics in a string.
+func (s Shape) String() string {
+	return fmt.Sprintf("Len:%d, Height:%d, BlackHeight:%d, Red:%d, Black:%d, AvgDepth:%0.2f, MaxDepth:%d",
+		s.Len, s.Height, s.BlackHeight, s.Red, s.Black, s.AvgDepth, s.MaxDepth)
+}
+
+// shapeOf walks the tree once and computes the metrics.
+func shapeOf[K constraints.Ordered](ctx context.Context, root *Node[K]) (Shape, error) {
+	poll := ctxPoller{ctx: ctx}
+	var s Shape
+	for node := root; node != nil; node = node.left {
+		if !node.red {
+			s.BlackHeight++
+		}
+	}
+
+	type depthObj struct {
+		node  *Node[K]
+		depth int
+	}
+	sum := 0
+	stack := append(make([]depthObj, 0, 64), depthObj{node: root})
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if d.node == nil {
+			continue
+		}
+		if err := poll.err(); err != nil {
+			return s, err
+		}
+
+		s.Len++
+		if d.node.red {
+			s.Red++
+		} else {
+			s.Black++
+		}
+		if d.depth >= len(s.Depths) {
+			s.Depths = append(s.Depths, 0)
+		}
+		s.Depths[d.depth]++
+		sum += d.depth
+		stack = append(stack,
+			depthObj{node: d.node.left, depth: d.depth + 1},
+			depthObj{node: d.node.right, depth: d.depth + 1})
+	}
+	s.Height = len(s.Depths)
+	if s.Height > 0 {
+		s.MaxDepth = s.Height - 1
+		s.AvgDepth = float64(sum) / float64(s.Len)
+	}
+	return s, nil
+}
+
+// checkHeight verifies that the height of the red-black tree is within
+// the bound of 2*log2(n+1).
+func checkHeight(s Shape) error {
+	if float64(s.Height) > 2*math.Log2(float64(s.Len+1)) {
+		return ErrHeightProperty
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShape(t *testing.T) {
+	title("Test Shape()")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	assert.Equal(Shape{}, tree.Shape())
+
+	//      ┌──[9]
+	//  ┌───7
+	//  │   └──[5]
+	//  3
+	//  └───1
+	for _, k := range []int{7, 1, 3, 9, 5} {
+		tree.Put(k, nil)
+	}
+	if LLRB234 {
+		s := tree.Shape()
+		assert.Equal(5, s.Len)
+		assert.Equal(3, s.Height)
+		assert.Equal(2, s.BlackHeight)
+		assert.Equal(2, s.Red)
+		assert.Equal(3, s.Black)
+		assert.Equal(2, s.MaxDepth)
+		assert.Equal(1.2, s.AvgDepth)
+		assert.Equal([]int{1, 2, 2}, s.Depths)
+		assert.Equal("Len:5, Height:3, BlackHeight:2, Red:2, Black:3, AvgDepth:1.20, MaxDepth:2", s.String())
+	}
+
+	// ascending keys are balanced too
+	tree = New[int]()
+	for i := 0; i < 100000; i++ {
+		tree.Put(i, nil)
+	}
+	s := tree.Shape()
+	assert.Equal(tree.Len(), s.Len)
+	assert.Equal(s.Len, s.Red+s.Black)
+	assert.LessOrEqual(float64(s.Height), 2*math.Log2(float64(s.Len+1)))
+	sum := 0
+	for _, n := range s.Depths {
+		sum += n
+	}
+	assert.Equal(s.Len, sum)
+	assertTreeCheck(t, tree, false)
+
+	// the height bound
+	assert.NoError(checkHeight(Shape{Len: 3, Height: 2}))
+	assert.ErrorContains(checkHeight(Shape{Len: 3, Height: 5}), "height property")
+}
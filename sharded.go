@@ -0,0 +1,509 @@
+package gomapllrb
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/constraints"
+)
+
+// ShardedTree is a concurrent ordered map which partitions the key space
+// into range shards. Each shard is a Tree with its own lock, so writers
+// hitting different key ranges don't block each other.
+//
+//	shards[0]: keys < bounds[0]
+//	shards[i]: bounds[i-1] <= keys < bounds[i]
+//	shards[n]: bounds[n-1] <= keys
+type ShardedTree[K constraints.Ordered] struct {
+	isLess  Comparator[K]  // data comparator (default: IsLess)
+	compare CompareFunc[K] // three-way comparator (default: cmp.Compare)
+
+	opts   []Option     // options of the shards
+	shards []*Tree[K]   // shards in key order
+	bounds []K          // lower bound keys of the shards except the first one
+	maxLen int          // split shards bigger than this, 0 disables it
+	splits uint64       // number of the splits, to resume the iterators
+	perf   PerfStats    // shared counters at the last ResetStats()
+	mutex  sync.RWMutex // protects the shard layout
+}
+
+// NewSharded creates a new sharded tree. The given keys are the boundaries
+// of the shards, so N keys make N+1 shards. The options are applied to every
+// shard, including the ones made by the splits.
+//
+//	tree := NewSharded([]string{"g", "n", "t"}, WithMetrics())
+func NewSharded[K constraints.Ordered](bounds []K, opts ...Option) *ShardedTree[K] {
+	st := &ShardedTree[K]{
+		isLess:  IsLess[K],
+		compare: cmp.Compare[K],
+		opts:    opts,
+		perf:    loadPerf(),
+	}
+	st.setBounds(bounds)
+	return st
+}
+
+// SetLess sets a user comparator function to all the shards.
+// It must be called before any key is stored, since the shards are built
+// again empty and the keys stored are dropped.
+func (st *ShardedTree[K]) SetLess(fn Comparator[K]) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.isLess = fn
+	st.compare = lessToCompare(fn)
+	st.setBounds(st.bounds)
+}
+
+// SetCompare sets a user three-way comparator function to all the shards.
+// It must be called before any key is stored, since the shards are built
+// again empty and the keys stored are dropped.
+func (st *ShardedTree[K]) SetCompare(fn CompareFunc[K]) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.compare = fn
+	st.isLess = compareToLess(fn)
+	st.setBounds(st.bounds)
+}
+
+// SetMaxShardLen enables online re-splitting. A shard is split in half
+// at its median key when it grows bigger than n keys. Zero disables it.
+func (st *ShardedTree[K]) SetMaxShardLen(n int) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.maxLen = n
+}
+
+// Put inserts a new key or replaces old if the same key is found.
+func (st *ShardedTree[K]) Put(name K, data interface{}) {
+	st.mutex.RLock()
+	tree := st.shard(name)
+	tree.Put(name, data)
+	split := st.maxLen > 0 && tree.Len() > st.maxLen
+	st.mutex.RUnlock()
+
+	if split {
+		st.split(tree)
+	}
+}
+
+// Delete deletes the key. It returns false if the key is not found.
+func (st *ShardedTree[K]) Delete(name K) bool {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.shard(name).Delete(name)
+}
+
+// Get returns the value of the key. If key is not found, it returns Nil.
+func (st *ShardedTree[K]) Get(name K) interface{} {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.shard(name).Get(name)
+}
+
+// Exist checks if the key exists.
+func (st *ShardedTree[K]) Exist(name K) bool {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.shard(name).Exist(name)
+}
+
+// Min returns a min key and value.
+func (st *ShardedTree[K]) Min() (K, interface{}, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.first(0)
+}
+
+// Max returns a max key and value.
+func (st *ShardedTree[K]) Max() (K, interface{}, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.last(len(st.shards) - 1)
+}
+
+// Bigger finds the next key bigger than given key.
+func (st *ShardedTree[K]) Bigger(name K) (K, interface{}, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	i := st.index(name)
+	if k, v, ok := st.shards[i].Bigger(name); ok {
+		return k, v, true
+	}
+	return st.first(i + 1)
+}
+
+// Smaller finds the next key smaller than given key.
+func (st *ShardedTree[K]) Smaller(name K) (K, interface{}, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	i := st.index(name)
+	if k, v, ok := st.shards[i].Smaller(name); ok {
+		return k, v, true
+	}
+	return st.last(i - 1)
+}
+
+// EqualOrBigger finds a matching key or the next bigger key.
+func (st *ShardedTree[K]) EqualOrBigger(name K) (K, interface{}, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	i := st.index(name)
+	if k, v, ok := st.shards[i].EqualOrBigger(name); ok {
+		return k, v, true
+	}
+	return st.first(i + 1)
+}
+
+// EqualOrSmaller finds a matching key or the next smaller key.
+func (st *ShardedTree[K]) EqualOrSmaller(name K) (K, interface{}, bool) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	i := st.index(name)
+	if k, v, ok := st.shards[i].EqualOrSmaller(name); ok {
+		return k, v, true
+	}
+	return st.last(i - 1)
+}
+
+// Clear empties all the shards. The shard layout is kept.
+func (st *ShardedTree[K]) Clear() {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	for _, tree := range st.shards {
+		tree.Clear()
+	}
+}
+
+// Len returns the number of object stored.
+func (st *ShardedTree[K]) Len() int {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	length := 0
+	for _, tree := range st.shards {
+		length += tree.Len()
+	}
+	return length
+}
+
+// Shards returns the number of shards.
+func (st *ShardedTree[K]) Shards() int {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return len(st.shards)
+}
+
+// Stats returns the sum of the statistics metrics of all the shards.
+func (st *ShardedTree[K]) Stats() Stats {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	var sum Stats
+	for _, tree := range st.shards {
+		s := tree.Stats()
+		sum.Put.Sum += s.Put.Sum
+		sum.Put.New += s.Put.New
+		sum.Put.Update += s.Put.Update
+		sum.Delete.Sum += s.Delete.Sum
+		sum.Delete.Deleted += s.Delete.Deleted
+		sum.Delete.NotFound += s.Delete.NotFound
+		sum.Get.Sum += s.Get.Sum
+		sum.Get.Found += s.Get.Found
+		sum.Get.NotFound += s.Get.NotFound
+		sum.Expired += s.Expired
+		sum.Evicted += s.Evicted
+		sum.Memory.Sum += s.Memory.Sum
+		sum.Memory.Nodes += s.Memory.Nodes
+		sum.Memory.Keys += s.Memory.Keys
+		sum.Memory.Values += s.Memory.Values
+		sum.Ops.merge(s.Ops)
+	}
+	// the counters are shared by the shards
+	sum.Perf = perfSince(st.perf)
+	return sum
+}
+
+// ResetStats resets all the satistics metrics.
+func (st *ShardedTree[K]) ResetStats() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.perf = loadPerf()
+	for _, tree := range st.shards {
+		tree.ResetStats()
+	}
+}
+
+// Map returns the tree in a map
+func (st *ShardedTree[K]) Map() map[K]interface{} {
+	m := make(map[K]interface{}, st.Len())
+	for it := st.Iter(); it.Next(); {
+		m[it.Key()] = it.Val()
+	}
+	return m
+}
+
+// Check checks the invariants of every shard and verifies that
+// the keys are stored in the right shard.
+func (st *ShardedTree[K]) Check() error {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	for i, tree := range st.shards {
+		if err := tree.Check(); err != nil {
+			return err
+		}
+		if min, _, ok := tree.Min(); ok && st.index(min) != i {
+			return fmt.Errorf("shard boundary violation found")
+		}
+		if max, _, ok := tree.Max(); ok && st.index(max) != i {
+			return fmt.Errorf("shard boundary violation found")
+		}
+	}
+	return nil
+}
+
+/*************************************************************************
+ * Iterator
+ ************************************************************************/
+
+// ShardedIter is a iterator object traveling across the shards.
+type ShardedIter[K constraints.Ordered] struct {
+	st     *ShardedTree[K]
+	tree   *Tree[K] // current shard
+	sub    *Iter[K] // iterator of the current shard
+	splits uint64   // number of the splits when the sub-iterator is made
+	last   K        // last key returned
+	seen   bool     // indicates the last key is set
+	start  K        // start boundary if span is set
+	end    K        // end boundary is span is set
+	span   bool     // indicates the end boundary is set
+	done   bool     // indicates the iteration is complete
+}
+
+// Iter returns an iterator.
+func (st *ShardedTree[K]) Iter() *ShardedIter[K] {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return &ShardedIter[K]{
+		st:     st,
+		tree:   st.shards[0],
+		sub:    st.shards[0].Iter(),
+		splits: st.splits,
+	}
+}
+
+// Range returns a ranged iterator.
+func (st *ShardedTree[K]) Range(start, end K) *ShardedIter[K] {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	tree := st.shard(start)
+	return &ShardedIter[K]{
+		st:     st,
+		tree:   tree,
+		sub:    tree.Range(start, end),
+		splits: st.splits,
+		start:  start,
+		end:    end,
+		span:   true,
+	}
+}
+
+// Next travels the keys in the tree.
+func (it *ShardedIter[K]) Next() bool {
+	it.st.mutex.RLock()
+	defer it.st.mutex.RUnlock()
+	for !it.done {
+		if it.splits != it.st.splits {
+			it.resume()
+		}
+		if it.sub.Next() {
+			it.last, it.seen = it.sub.Key(), true
+			if it.span && it.st.isLess(it.end, it.last) {
+				break
+			}
+			return true
+		}
+		it.sub = it.advance()
+	}
+	it.done = true
+	return false
+}
+
+// resume restarts the sub-iterator after the shards are split, since it
+// may hold the nodes moved to another shard. It continues from the last
+// key in the shard holding it now. The caller must hold the read lock.
+func (it *ShardedIter[K]) resume() {
+	it.splits = it.st.splits
+	switch {
+	case it.seen:
+		it.tree = it.st.shard(it.last)
+		it.sub = it.tree.iterFrom(it.last, false)
+	case it.span:
+		it.tree = it.st.shard(it.start)
+		it.sub = it.tree.iterFrom(it.start, true)
+	default:
+		it.tree = it.st.shards[0]
+		it.sub = it.tree.Iter()
+	}
+}
+
+// advance moves on to the next shard when the current one is exhausted.
+// The caller must hold the read lock.
+func (it *ShardedIter[K]) advance() *Iter[K] {
+	i := 0
+	for i < len(it.st.shards) && it.st.shards[i] != it.tree {
+		i++
+	}
+	if i+1 >= len(it.st.shards) {
+		it.done = true
+		return it.sub
+	}
+	it.tree = it.st.shards[i+1]
+	if it.seen && !it.st.isLess(it.last, it.st.bounds[i]) {
+		return it.tree.iterFrom(it.last, false)
+	}
+	if it.span && it.st.isLess(it.end, it.st.bounds[i]) {
+		it.done = true
+		return it.sub
+	}
+	return it.tree.iterFrom(it.st.bounds[i], true)
+}
+
+// Key returns the key name.
+func (it *ShardedIter[K]) Key() K {
+	return it.sub.Key()
+}
+
+// Val returns the value data.
+func (it *ShardedIter[K]) Val() interface{} {
+	return it.sub.Val()
+}
+
+/*************************************************************************
+ * Shard management functions
+ ************************************************************************/
+
+// setBounds sorts the boundaries and rebuilds the empty shard layout.
+func (st *ShardedTree[K]) setBounds(bounds []K) {
+	sorted := make([]K, 0, len(bounds))
+	sorted = append(sorted, bounds...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return st.isLess(sorted[i], sorted[j])
+	})
+	st.bounds = st.bounds[:0]
+	for i, k := range sorted {
+		if i == 0 || st.isLess(sorted[i-1], k) {
+			st.bounds = append(st.bounds, k)
+		}
+	}
+	st.shards = make([]*Tree[K], len(st.bounds)+1)
+	for i := range st.shards {
+		st.shards[i] = st.newShard()
+	}
+}
+
+func (st *ShardedTree[K]) newShard() *Tree[K] {
+	tree := New[K](st.opts...)
+	tree.isLess, tree.compare = st.isLess, st.compare
+	return tree
+}
+
+// index returns the index of the shard the key belongs to.
+func (st *ShardedTree[K]) index(name K) int {
+	return sort.Search(len(st.bounds), func(i int) bool {
+		return st.isLess(name, st.bounds[i])
+	})
+}
+
+func (st *ShardedTree[K]) shard(name K) *Tree[K] {
+	return st.shards[st.index(name)]
+}
+
+// first returns the min key of the shards starting from the index.
+func (st *ShardedTree[K]) first(i int) (K, interface{}, bool) {
+	for ; i < len(st.shards); i++ {
+		if k, v, ok := st.shards[i].Min(); ok {
+			return k, v, true
+		}
+	}
+	var n K
+	return n, nil, false
+}
+
+// last returns the max key of the shards starting backward from the index.
+func (st *ShardedTree[K]) last(i int) (K, interface{}, bool) {
+	for ; i >= 0; i-- {
+		if k, v, ok := st.shards[i].Max(); ok {
+			return k, v, true
+		}
+	}
+	var n K
+	return n, nil, false
+}
+
+// split splits the shard in half at its median key.
+func (st *ShardedTree[K]) split(tree *Tree[K]) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	i := 0
+	for i < len(st.shards) && st.shards[i] != tree {
+		i++
+	}
+	// the shard might be split already by another writer
+	if i == len(st.shards) || st.maxLen <= 0 || tree.Len() <= st.maxLen {
+		return
+	}
+
+	// move the upper half to a new shard
+	upper := st.newShard()
+	tree.mutex.Lock()
+	median := tree.splitHalf(upper)
+	tree.mutex.Unlock()
+	st.splits++
+
+	st.shards = append(st.shards, nil)
+	copy(st.shards[i+2:], st.shards[i+1:])
+	st.shards[i+1] = upper
+	st.bounds = append(st.bounds, median)
+	copy(st.bounds[i+1:], st.bounds[i:])
+	st.bounds[i] = median
+}
+
+// splitHalf moves the keys from the median up to the empty tree and returns
+// the median. The keys are moved with the internal functions, so the moves
+// aren't counted in the statistics nor recorded or notified as the user
+// operations. The caller must hold the write lock of the tree. The shards
+// have no TTLs and eviction.
+func (tree *Tree[K]) splitHalf(upper *Tree[K]) K {
+	nodes := make([]*Node[K], 0, tree.len)
+	stack := make([]*Node[K], 0, 64)
+	for node := tree.root; node != nil || len(stack) > 0; {
+		for ; node != nil; node = node.left {
+			stack = append(stack, node)
+		}
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		nodes = append(nodes, node)
+		node = node.right
+	}
+	// copy them first since the deletes move the keys between the nodes
+	nodes = nodes[len(nodes)/2:]
+	names := make([]K, len(nodes))
+	datas := make([]interface{}, len(nodes))
+	for i, node := range nodes {
+		names[i], datas[i] = node.name, node.data
+	}
+
+	for i, name := range names {
+		old, _ := tree.delete(name)
+		tree.mem.remove(name, old)
+		upper.put(name, datas[i])
+		upper.root.red = false
+		upper.mem.put(name, nil, datas[i], false)
+	}
+	if tree.root != nil {
+		tree.root.red = false
+	}
+	upper.stats = Stats{}
+	return names[0]
+}
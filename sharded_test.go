@@ -0,0 +1,202 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharded(t *testing.T) {
+	title("Test ShardedTree")
+	assert := assert.New(t)
+
+	tree := NewSharded([]int{300, 100, 200, 200})
+	assert.Equal(4, tree.Shards())
+	assert.Equal(0, tree.Len())
+
+	// test empty table
+	_, _, e := tree.Min()
+	assert.False(e)
+	_, _, e = tree.Max()
+	assert.False(e)
+	assert.False(tree.Iter().Next())
+
+	// keys spread over the shards, leaving the shard 200-300 empty
+	keys := []int{350, 10, 150, 50, 110, 400, 190, 0}
+	for _, k := range keys {
+		tree.Put(k, k)
+	}
+	assert.NoError(tree.Check())
+	assert.Equal(len(keys), tree.Len())
+	for _, k := range keys {
+		assert.True(tree.Exist(k))
+		assert.Equal(k, tree.Get(k))
+	}
+	assert.Nil(tree.Get(250))
+
+	// test Min/Max
+	min, _, _ := tree.Min()
+	assert.Equal(0, min)
+	max, _, _ := tree.Max()
+	assert.Equal(400, max)
+
+	// test getters across the shards
+	k, _, e := tree.Bigger(190)
+	assert.True(e)
+	assert.Equal(350, k)
+	k, _, e = tree.Smaller(350)
+	assert.True(e)
+	assert.Equal(190, k)
+	k, _, e = tree.EqualOrBigger(100)
+	assert.True(e)
+	assert.Equal(110, k)
+	k, _, e = tree.EqualOrSmaller(100)
+	assert.True(e)
+	assert.Equal(50, k)
+	_, _, e = tree.Bigger(400)
+	assert.False(e)
+	_, _, e = tree.Smaller(0)
+	assert.False(e)
+
+	// test iteration
+	var got []int
+	for it := tree.Iter(); it.Next(); {
+		got = append(got, it.Key())
+		assert.Equal(it.Key(), it.Val())
+	}
+	assert.Equal([]int{0, 10, 50, 110, 150, 190, 350, 400}, got)
+
+	got = nil
+	for it := tree.Range(20, 360); it.Next(); {
+		got = append(got, it.Key())
+	}
+	assert.Equal([]int{50, 110, 150, 190, 350}, got)
+
+	got = nil
+	for it := tree.Range(200, 300); it.Next(); {
+		got = append(got, it.Key())
+	}
+	assert.Nil(got)
+	assert.Equal(len(keys), len(tree.Map()))
+
+	// delete
+	for _, k := range keys {
+		assert.True(tree.Delete(k))
+	}
+	assert.False(tree.Delete(0))
+	assert.Equal(0, tree.Len())
+
+	stats := tree.Stats()
+	assert.Equal(uint64(len(keys)), stats.Put.New)
+	assert.Equal(uint64(len(keys)), stats.Delete.Deleted)
+}
+
+func TestShardedStats(t *testing.T) {
+	title("Test ShardedTree Stats()")
+	assert := assert.New(t)
+
+	assert.False(NewSharded([]int{100}).Stats().Ops.Enabled)
+	tree := NewSharded([]int{100}, WithMetrics())
+	tree.Put(1, nil)
+	tree.Put(200, nil)
+	tree.Put(300, nil)
+	tree.Get(1)
+
+	ops := tree.Stats().Ops
+	assert.True(ops.Enabled)
+	assert.Equal(uint64(3), ops.Put.Count)
+	assert.Equal(uint64(3), ops.Put.Latency.Count)
+	assert.Equal(uint64(1), ops.Get.Count)
+	assert.Equal(uint64(3), ops.WriteLock.Count)
+	assert.Equal(uint64(3), ops.Rotate.Count)
+}
+
+func TestShardedSplit(t *testing.T) {
+	title("Test ShardedTree re-splitting")
+	assert := assert.New(t)
+
+	other := New[int]() // rotates before the tree is made
+	for i := 0; i < 100; i++ {
+		other.Put(i, nil)
+	}
+	perf := loadPerf()
+	tree := NewSharded[int](nil, WithMetrics())
+	tree.SetMaxShardLen(100)
+	for i := 0; i < 1000; i++ {
+		tree.Put(int(hash32(i)%10000), i)
+	}
+	assert.Less(1, tree.Shards())
+	assert.NoError(tree.Check())
+
+	prev := -1
+	num := 0
+	for it := tree.Iter(); it.Next(); num++ {
+		assert.Less(prev, it.Key())
+		prev = it.Key()
+	}
+	assert.Equal(tree.Len(), num)
+
+	// the moves by the splits are not counted
+	stats := tree.Stats()
+	assert.Equal(uint64(1000), stats.Put.Sum)
+	assert.Equal(uint64(0), stats.Delete.Sum)
+
+	// the shards made by the splits have the options and the shared
+	// counters are reported once from the creation
+	assert.Equal(uint64(1000), stats.Ops.Put.Count)
+	assert.Equal(perfSince(perf), stats.Perf)
+	tree.ResetStats()
+	assert.Equal(PerfStats{}, tree.Stats().Perf)
+
+	// iterate across the splits
+	tree = NewSharded[int](nil)
+	tree.SetMaxShardLen(50)
+	for i := 0; i < 1000; i += 2 {
+		tree.Put(i, i)
+	}
+	var got []int
+	for it := tree.Iter(); it.Next(); {
+		got = append(got, it.Key())
+		if it.Key()%100 == 0 {
+			// split the shards around, except the next key which
+			// the iterator of the shard has fetched already
+			for i := it.Key() - 49; i < it.Key()+50; i += 2 {
+				if i != it.Key()+1 {
+					tree.Put(i, i)
+				}
+			}
+		}
+	}
+	assert.Less(20, tree.Shards())
+	var want []int // the keys put after passing them are not seen
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 || (i%100 > 1 && i%100 < 50) {
+			want = append(want, i)
+		}
+	}
+	assert.Equal(want, got)
+}
+
+func TestShardedConcurrency(t *testing.T) {
+	title("Test ShardedTree concurrency")
+	assert := assert.New(t)
+
+	tree := NewSharded([]int{2500, 5000, 7500})
+	tree.SetMaxShardLen(1000)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 10000; i += 8 {
+				tree.Put(i, i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	assert.Equal(10000, tree.Len())
+	assert.NoError(tree.Check())
+}
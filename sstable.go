@@ -0,0 +1,677 @@
+package gomapllrb
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+
+	"golang.org/x/exp/constraints"
+)
+
+// SSTableOptions configures the file written by WriteSSTable().
+type SSTableOptions struct {
+	BlockSize int // approximate size of the data blocks (default: 4096)
+	// BloomBits is the bits per key of the bloom filter, 0 disables it.
+	// The filter hashes the encoding of the keys, so the Reader skips it
+	// with a custom comparator, which may take differently encoded keys
+	// equal.
+	BloomBits int
+}
+
+// ErrSSTableCorrupt is returned when an SSTable file is malformed or fails
+// the checksum.
+var ErrSSTableCorrupt = errors.New("sstable corrupted")
+
+// WriteSSTable writes the keys of the tree to an immutable sorted file,
+// which is read by a Reader. The expired keys are left out. The keys are
+// copied under the read lock and written after releasing it.
+//
+//	data block 1..N   keys and values in order, with a checksum each
+//	index block       first key, offset and length of each data block
+//	bloom block       bloom filter of the keys, optional
+//	footer            offsets of the index and the bloom blocks
+//
+// The keys are encoded in binary as they are. The values are encoded in
+// JSON, so they are read as decoded by encoding/json, such as float64 for
+// the numbers.
+//
+//	f, _ := os.Create("data.sst")
+//	err := tree.WriteSSTable(f, SSTableOptions{BloomBits: 10})
+func (tree *Tree[K]) WriteSSTable(w io.Writer, opts SSTableOptions) error {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 4096
+	}
+
+	type itemObj struct {
+		name K
+		data interface{}
+	}
+	tree.mutex.RLock()
+	items := make([]itemObj, 0, tree.len)
+	stack := make([]*Node[K], 0, 64)
+	for node := tree.root; node != nil || len(stack) > 0; {
+		for ; node != nil; node = node.left {
+			stack = append(stack, node)
+		}
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !tree.isExpired(node.name) {
+			items = append(items, itemObj{node.name, node.data})
+		}
+		node = node.right
+	}
+	tree.mutex.RUnlock()
+
+	sw := &sstWriter{w: bufio.NewWriter(w)}
+	var filter *bloomFilter
+	if opts.BloomBits > 0 {
+		filter = newBloomFilter(len(items), opts.BloomBits)
+	}
+	var index, block bytes.Buffer
+	var blocks int
+	flush := func() {
+		if block.Len() == 0 {
+			return
+		}
+		putUvarint(&index, uint64(sw.off))
+		putUvarint(&index, uint64(block.Len()))
+		sw.writeBlock(block.Bytes())
+		block.Reset()
+		blocks++
+	}
+	for _, item := range items {
+		key := sstKey(item.name)
+		val, err := json.Marshal(item.data)
+		if err != nil {
+			return fmt.Errorf("key %v: %w", item.name, err)
+		}
+		if block.Len() == 0 {
+			putBytes(&index, key)
+		}
+		putBytes(&block, key)
+		putBytes(&block, val)
+		if filter != nil {
+			filter.add(bloomKey(item.name))
+		}
+		if block.Len() >= opts.BlockSize {
+			flush()
+		}
+	}
+	flush()
+
+	var footer [sstFooterSize]byte
+	var head bytes.Buffer
+	putUvarint(&head, uint64(blocks))
+	binary.LittleEndian.PutUint64(footer[0:], uint64(sw.off))
+	binary.LittleEndian.PutUint64(footer[8:], uint64(head.Len()+index.Len()))
+	sw.writeBlock(append(head.Bytes(), index.Bytes()...))
+	if filter != nil {
+		binary.LittleEndian.PutUint64(footer[16:], uint64(sw.off))
+		binary.LittleEndian.PutUint64(footer[24:], uint64(1+len(filter.bits)))
+		sw.writeBlock(append([]byte{byte(filter.k)}, filter.bits...))
+	}
+	binary.LittleEndian.PutUint64(footer[32:], uint64(len(items)))
+	binary.LittleEndian.PutUint64(footer[40:], sstMagic)
+	sw.write(footer[:])
+	if sw.err != nil {
+		return sw.err
+	}
+	return sw.w.Flush()
+}
+
+// Reader reads an SSTable file written by WriteSSTable() in the same way as
+// the tree, straight from the disk. Only the index and the bloom filter are
+// kept in memory, and a lookup reads a data block. It's safe for concurrent
+// use except the iterators.
+//
+// The methods return not found on the read errors, which are kept in Err().
+type Reader[K constraints.Ordered] struct {
+	r       io.ReaderAt
+	closer  io.Closer // set if opened by OpenSSTable()
+	size    int64
+	compare CompareFunc[K]
+	len     int
+	index   []sstBlock[K]
+	bloom   *bloomFilter // nil if not written or skipped
+
+	mutex sync.Mutex // protects err
+	err   error      // first read error
+}
+
+// OpenSSTable opens an SSTable file. Close it after use.
+func OpenSSTable[K constraints.Ordered](path string) (*Reader[K], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := NewReader[K](f, st.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.closer = f
+	return r, nil
+}
+
+// NewReader creates a reader of an SSTable of the size. It reads the index
+// and the bloom filter and verifies them.
+func NewReader[K constraints.Ordered](ra io.ReaderAt, size int64) (*Reader[K], error) {
+	if size < sstFooterSize {
+		return nil, fmt.Errorf("%w: too short", ErrSSTableCorrupt)
+	}
+	var footer [sstFooterSize]byte
+	if _, err := ra.ReadAt(footer[:], size-sstFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint64(footer[40:]) != sstMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrSSTableCorrupt)
+	}
+	r := &Reader[K]{
+		r:       ra,
+		size:    size,
+		compare: cmp.Compare[K],
+		len:     int(binary.LittleEndian.Uint64(footer[32:])),
+	}
+
+	data, err := r.readBlock(int64(binary.LittleEndian.Uint64(footer[0:])), int64(binary.LittleEndian.Uint64(footer[8:])))
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewReader(data)
+	n, err := binary.ReadUvarint(buf)
+	if err == nil && n > uint64(buf.Len()) {
+		// an entry takes a byte at least
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: index: %v", ErrSSTableCorrupt, err)
+	}
+	r.index = make([]sstBlock[K], 0, n)
+	for i := uint64(0); i < n; i++ {
+		var b sstBlock[K]
+		key, err := getBytes(buf)
+		if err == nil {
+			b.first, err = sstDecodeKey[K](key)
+		}
+		if err == nil {
+			b.off, err = getUvarint(buf)
+		}
+		if err == nil {
+			b.len, err = getUvarint(buf)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: index: %v", ErrSSTableCorrupt, err)
+		}
+		r.index = append(r.index, b)
+	}
+
+	if off, n := int64(binary.LittleEndian.Uint64(footer[16:])), int64(binary.LittleEndian.Uint64(footer[24:])); n > 0 {
+		data, err := r.readBlock(off, n)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 2 || data[0] == 0 {
+			return nil, fmt.Errorf("%w: bloom filter", ErrSSTableCorrupt)
+		}
+		r.bloom = &bloomFilter{k: int(data[0]), bits: data[1:]}
+	}
+	return r, nil
+}
+
+// SetCompare sets the three-way comparator the file was sorted with, which
+// is the one of the tree written. The bloom filter is not used then, since
+// the keys equal by the comparator may have different encodings.
+func (r *Reader[K]) SetCompare(fn CompareFunc[K]) {
+	r.compare = fn
+	r.bloom = nil
+}
+
+// Len returns the number of the keys in the file.
+func (r *Reader[K]) Len() int {
+	return r.len
+}
+
+// Get returns the value data of the key, or nil if not found.
+func (r *Reader[K]) Get(name K) interface{} {
+	data, _ := r.get(name)
+	return data
+}
+
+// Exist checks if the key exists.
+func (r *Reader[K]) Exist(name K) bool {
+	_, found := r.get(name)
+	return found
+}
+
+// EqualOrBigger finds the key or the next bigger one.
+func (r *Reader[K]) EqualOrBigger(name K) (K, interface{}, bool) {
+	it := r.iterFrom(name)
+	if it.Next() {
+		return it.Key(), it.Val(), true
+	}
+	var n K
+	return n, nil, false
+}
+
+// EqualOrSmaller finds the key or the next smaller one.
+func (r *Reader[K]) EqualOrSmaller(name K) (K, interface{}, bool) {
+	var n K
+	i := r.blockFor(name)
+	if i < 0 {
+		return n, nil, false
+	}
+	entries, err := r.loadBlock(i)
+	if err != nil {
+		return n, nil, false
+	}
+	// the first key of the block is equal or smaller
+	j := sort.Search(len(entries), func(j int) bool { return r.compare(entries[j].name, name) > 0 }) - 1
+	data, err := r.decode(entries[j].data)
+	if err != nil {
+		return n, nil, false
+	}
+	return entries[j].name, data, true
+}
+
+// Iter returns an iterator.
+func (r *Reader[K]) Iter() *ReaderIter[K] {
+	it := &ReaderIter[K]{r: r, block: -1}
+	it.load(0)
+	return it
+}
+
+// Range returns a ranged iterator.
+func (r *Reader[K]) Range(start, end K) *ReaderIter[K] {
+	it := r.iterFrom(start)
+	it.end, it.span = end, true
+	return it
+}
+
+// Err returns the first error of reading the file.
+func (r *Reader[K]) Err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+// Close closes the file opened by OpenSSTable().
+func (r *Reader[K]) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// ReaderIter is an iterator of Reader.
+type ReaderIter[K constraints.Ordered] struct {
+	r       *Reader[K]
+	block   int // index of the block loaded
+	entries []sstEntry[K]
+	pos     int         // next entry in the block
+	name    K           // last key after Next()
+	data    interface{} // last value after Next()
+	end     K           // end boundary is span is set
+	span    bool        // indicates the end boundary is set
+	done    bool        // indicates the iteration is complete
+	err     error       // the read error stopped the iteration
+}
+
+// Next travels the keys in the file.
+func (it *ReaderIter[K]) Next() bool {
+	for !it.done && it.pos == len(it.entries) {
+		it.load(it.block + 1)
+	}
+	if it.done {
+		return false
+	}
+	e := it.entries[it.pos]
+	if it.span && it.r.compare(it.end, e.name) < 0 {
+		it.done = true
+		return false
+	}
+	data, err := it.r.decode(e.data)
+	if err != nil {
+		it.err, it.done = err, true
+		return false
+	}
+	it.name, it.data = e.name, data
+	it.pos++
+	return true
+}
+
+// Key returns the key name.
+func (it *ReaderIter[K]) Key() K {
+	return it.name
+}
+
+// Val returns the value data.
+func (it *ReaderIter[K]) Val() interface{} {
+	return it.data
+}
+
+// Err returns the read error if the iteration has been stopped by it.
+func (it *ReaderIter[K]) Err() error {
+	return it.err
+}
+
+/*************************************************************************
+ * SSTable functions
+ ************************************************************************/
+
+const (
+	sstFooterSize = 48
+	sstMagic      = 0x3254535342524c4c // "LLRBSST2"
+)
+
+var sstCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// sstBlock is an index entry of a data block.
+type sstBlock[K constraints.Ordered] struct {
+	first K
+	off   uint64
+	len   uint64
+}
+
+// sstEntry is a key in a data block with its encoded value.
+type sstEntry[K constraints.Ordered] struct {
+	name K
+	data []byte
+}
+
+// sstWriter writes the blocks keeping the offset and the first error.
+type sstWriter struct {
+	w   *bufio.Writer
+	off int64
+	err error
+}
+
+func (sw *sstWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	var n int
+	n, sw.err = sw.w.Write(p)
+	sw.off += int64(n)
+}
+
+// writeBlock writes the block followed by its checksum.
+func (sw *sstWriter) writeBlock(p []byte) {
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.Checksum(p, sstCRC))
+	sw.write(p)
+	sw.write(sum[:])
+}
+
+// get finds the key with the help of the bloom filter.
+func (r *Reader[K]) get(name K) (interface{}, bool) {
+	if r.bloom != nil && !r.bloom.has(bloomKey(name)) {
+		return nil, false
+	}
+	i := r.blockFor(name)
+	if i < 0 {
+		return nil, false
+	}
+	entries, err := r.loadBlock(i)
+	if err != nil {
+		return nil, false
+	}
+	j := sort.Search(len(entries), func(j int) bool { return r.compare(entries[j].name, name) >= 0 })
+	if j == len(entries) || r.compare(entries[j].name, name) != 0 {
+		return nil, false
+	}
+	data, err := r.decode(entries[j].data)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// blockFor returns the last block starting with the key or a smaller one,
+// or -1 if the key is smaller than all.
+func (r *Reader[K]) blockFor(name K) int {
+	return sort.Search(len(r.index), func(i int) bool { return r.compare(r.index[i].first, name) > 0 }) - 1
+}
+
+// iterFrom returns an iterator starting from the key or the next bigger one.
+func (r *Reader[K]) iterFrom(name K) *ReaderIter[K] {
+	it := &ReaderIter[K]{r: r, block: -1}
+	i := r.blockFor(name)
+	if i < 0 {
+		it.load(0)
+		return it
+	}
+	it.load(i)
+	if !it.done {
+		it.pos = sort.Search(len(it.entries), func(j int) bool { return r.compare(it.entries[j].name, name) >= 0 })
+	}
+	return it
+}
+
+// load loads the block for the iterator.
+func (it *ReaderIter[K]) load(i int) {
+	it.block, it.entries, it.pos = i, nil, 0
+	if i >= len(it.r.index) {
+		it.done = true
+		return
+	}
+	entries, err := it.r.loadBlock(i)
+	if err != nil {
+		it.err, it.done = err, true
+		return
+	}
+	it.entries = entries
+}
+
+// loadBlock reads and decodes the keys of a data block.
+func (r *Reader[K]) loadBlock(i int) ([]sstEntry[K], error) {
+	b := r.index[i]
+	data, err := r.readBlock(int64(b.off), int64(b.len))
+	if err != nil {
+		return nil, err
+	}
+	var entries []sstEntry[K]
+	for buf := bytes.NewReader(data); buf.Len() > 0; {
+		var e sstEntry[K]
+		key, err := getBytes(buf)
+		if err == nil {
+			e.name, err = sstDecodeKey[K](key)
+		}
+		if err == nil {
+			e.data, err = getBytes(buf)
+		}
+		if err != nil {
+			return nil, r.setErr(fmt.Errorf("%w: block at %d: %v", ErrSSTableCorrupt, b.off, err))
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, r.setErr(fmt.Errorf("%w: empty block at %d", ErrSSTableCorrupt, b.off))
+	}
+	return entries, nil
+}
+
+// readBlock reads a block and verifies its checksum.
+func (r *Reader[K]) readBlock(off, n int64) ([]byte, error) {
+	if off < 0 || n < 0 || off > r.size || n > r.size-off-4 {
+		return nil, r.setErr(fmt.Errorf("%w: block out of range at %d", ErrSSTableCorrupt, off))
+	}
+	data := make([]byte, n+4)
+	if _, err := r.r.ReadAt(data, off); err != nil {
+		return nil, r.setErr(err)
+	}
+	if crc32.Checksum(data[:n], sstCRC) != binary.LittleEndian.Uint32(data[n:]) {
+		return nil, r.setErr(fmt.Errorf("%w: checksum mismatch at %d", ErrSSTableCorrupt, off))
+	}
+	return data[:n], nil
+}
+
+func (r *Reader[K]) decode(p []byte) (interface{}, error) {
+	var data interface{}
+	if err := json.Unmarshal(p, &data); err != nil {
+		return nil, r.setErr(fmt.Errorf("%w: %v", ErrSSTableCorrupt, err))
+	}
+	return data, nil
+}
+
+// setErr keeps the first error.
+func (r *Reader[K]) setErr(err error) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return err
+}
+
+func putUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func putBytes(buf *bytes.Buffer, p []byte) {
+	putUvarint(buf, uint64(len(p)))
+	buf.Write(p)
+}
+
+func getUvarint(buf *bytes.Reader) (uint64, error) {
+	v, err := binary.ReadUvarint(buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func getBytes(buf *bytes.Reader) ([]byte, error) {
+	n, err := getUvarint(buf)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(buf.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := make([]byte, n)
+	buf.Read(p)
+	return p, nil
+}
+
+// sstKey encodes the key by its kind. The strings are kept as they are,
+// the integers are in varints and the floats are in their IEEE 754 bits.
+func sstKey[K constraints.Ordered](name K) []byte {
+	v := reflect.ValueOf(name)
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(nil, v.Int())
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v.Float()))
+	default: // unsigned integers
+		return binary.AppendUvarint(nil, v.Uint())
+	}
+}
+
+// sstDecodeKey decodes the key encoded by sstKey().
+func sstDecodeKey[K constraints.Ordered](p []byte) (K, error) {
+	var name K
+	v := reflect.ValueOf(&name).Elem()
+	ok := false
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(p))
+		ok = true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, n := binary.Varint(p)
+		v.SetInt(i)
+		ok = n == len(p) && !v.OverflowInt(i)
+	case reflect.Float32:
+		if ok = len(p) == 4; ok {
+			v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(p))))
+		}
+	case reflect.Float64:
+		if ok = len(p) == 8; ok {
+			v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(p)))
+		}
+	default: // unsigned integers
+		u, n := binary.Uvarint(p)
+		v.SetUint(u)
+		ok = n == len(p) && !v.OverflowUint(u)
+	}
+	if !ok {
+		return name, fmt.Errorf("bad key of %d bytes", len(p))
+	}
+	return name, nil
+}
+
+// bloomKey returns the encoding of the key hashed by the bloom filter. The
+// negative zero of the floats is turned to the zero, which is the only
+// different encoding of the keys equal by cmp.Compare.
+func bloomKey[K constraints.Ordered](name K) []byte {
+	var zero K
+	if name == zero {
+		name = zero
+	}
+	return sstKey(name)
+}
+
+// bloomFilter is a bloom filter with k hashes made by double hashing.
+type bloomFilter struct {
+	k    int
+	bits []byte
+}
+
+func newBloomFilter(n, bitsPerKey int) *bloomFilter {
+	m := n * bitsPerKey
+	if m < 64 {
+		m = 64
+	}
+	// k = ln2 * bits per key is optimal
+	k := min(max(bitsPerKey*69/100, 1), 30)
+	return &bloomFilter{k: k, bits: make([]byte, (m+7)/8)}
+}
+
+func (f *bloomFilter) add(key []byte) {
+	h1, h2 := bloomHash(key)
+	m := uint64(len(f.bits) * 8)
+	for i := 0; i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		f.bits[pos/8] |= 1 << (pos % 8)
+	}
+}
+
+func (f *bloomFilter) has(key []byte) bool {
+	h1, h2 := bloomHash(key)
+	m := uint64(len(f.bits) * 8)
+	for i := 0; i < f.k; i++ {
+		pos := (h1 + uint64(i)*h2) % m
+		if f.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomHash(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
@@ -0,0 +1,198 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/constraints"
+)
+
+func TestSSTable(t *testing.T) {
+	title("Test WriteSSTable() and Reader")
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "data.sst")
+
+	tree := New[int]()
+	for i := 0; i < 10000; i += 2 {
+		tree.Put(i, fmt.Sprint(i))
+	}
+	f, err := os.Create(path)
+	assert.NoError(err)
+	assert.NoError(tree.WriteSSTable(f, SSTableOptions{BlockSize: 256, BloomBits: 10}))
+	assert.NoError(f.Close())
+
+	r, err := OpenSSTable[int](path)
+	assert.NoError(err)
+	defer r.Close()
+	assert.Equal(5000, r.Len())
+	assert.Greater(len(r.index), 100)
+	for i := -10; i < 10010; i++ {
+		assert.Equal(tree.Get(i), r.Get(i))
+		assert.Equal(tree.Exist(i), r.Exist(i))
+
+		k1, v1, ok1 := tree.EqualOrBigger(i)
+		k2, v2, ok2 := r.EqualOrBigger(i)
+		assert.Equal([]interface{}{k1, v1, ok1}, []interface{}{k2, v2, ok2})
+		k1, v1, ok1 = tree.EqualOrSmaller(i)
+		k2, v2, ok2 = r.EqualOrSmaller(i)
+		assert.Equal([]interface{}{k1, v1, ok1}, []interface{}{k2, v2, ok2})
+	}
+
+	keys := func(next func() bool, key func() int) []int {
+		var names []int
+		for next() {
+			names = append(names, key())
+		}
+		return names
+	}
+	tit, it := tree.Iter(), r.Iter()
+	assert.Equal(keys(tit.Next, tit.Key), keys(it.Next, it.Key))
+	for _, span := range [][2]int{{-5, 5}, {101, 999}, {1000, 1000}, {1001, 1001}, {9990, 20000}, {5, 1}} {
+		tit, rit := tree.Range(span[0], span[1]), r.Range(span[0], span[1])
+		assert.Equal(keys(tit.Next, tit.Key), keys(rit.Next, rit.Key))
+	}
+	it = r.Range(500, 502)
+	assert.True(it.Next())
+	assert.Equal("500", it.Val())
+	assert.NoError(r.Err())
+
+	// empty and reversed
+	var buf bytes.Buffer
+	assert.NoError(New[string]().WriteSSTable(&buf, SSTableOptions{}))
+	empty, err := NewReader[string](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	assert.Nil(empty.Get("a"))
+	assert.False(empty.Iter().Next())
+	_, _, ok := empty.EqualOrSmaller("a")
+	assert.False(ok)
+
+	reverse := func(a, b string) int { return cmp.Compare(b, a) }
+	rtree := New[string]()
+	rtree.SetCompare(reverse)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		rtree.Put(k, k)
+	}
+	buf.Reset()
+	assert.NoError(rtree.WriteSSTable(&buf, SSTableOptions{BlockSize: 1}))
+	rr, err := NewReader[string](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	rr.SetCompare(reverse)
+	assert.Equal("c", rr.Get("c"))
+	k, _, _ := rr.EqualOrBigger("bb")
+	assert.Equal("b", k)
+	k, _, _ = rr.EqualOrSmaller("bb")
+	assert.Equal("c", k)
+
+	// the bloom filter with the keys equal but encoded differently
+	ftree := New[float64]()
+	ftree.Put(-0.0, "zero")
+	buf.Reset()
+	assert.NoError(ftree.WriteSSTable(&buf, SSTableOptions{BloomBits: 10}))
+	fr, err := NewReader[float64](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	assert.Equal("zero", fr.Get(0.0))
+	fold := func(a, b string) int { return cmp.Compare(strings.ToLower(a), strings.ToLower(b)) }
+	ctree := New[string]()
+	ctree.SetCompare(fold)
+	ctree.Put("Key", "v")
+	buf.Reset()
+	assert.NoError(ctree.WriteSSTable(&buf, SSTableOptions{BloomBits: 10}))
+	cr0, err := NewReader[string](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	cr0.SetCompare(fold)
+	assert.Equal("v", cr0.Get("KEY"))
+	assert.Equal(ctree.Get("KEY"), cr0.Get("KEY"))
+
+	// the keys kept as they are
+	stree := New[string]()
+	stree.Put("\xff", 1)
+	stree.Put("\xfe", 2)
+	buf.Reset()
+	assert.NoError(stree.WriteSSTable(&buf, SSTableOptions{BloomBits: 10}))
+	sr, err := NewReader[string](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+	assert.Equal(2, sr.Len())
+	assert.True(sr.Exist("\xff"))
+	assert.True(sr.Exist("\xfe"))
+	assert.False(sr.Exist("\ufffd"))
+	assert.Equal(2.0, sr.Get("\xfe"))
+	assertKeyCodec(assert, []int8{math.MinInt8, -1, 0, math.MaxInt8})
+	assertKeyCodec(assert, []uint16{0, 1, math.MaxUint16})
+	assertKeyCodec(assert, []int64{math.MinInt64, math.MaxInt64})
+	assertKeyCodec(assert, []float32{float32(math.Inf(-1)), -1.5, 0, math.MaxFloat32})
+	assertKeyCodec(assert, []string{"", "a", "\x00\xff"})
+	_, err = sstDecodeKey[int8](sstKey(300))
+	assert.Error(err)
+	_, err = sstDecodeKey[float64]([]byte{1, 2, 3})
+	assert.Error(err)
+
+	// corruption
+	data, err := os.ReadFile(path)
+	assert.NoError(err)
+	data[10] ^= 0xff
+	cr, err := NewReader[int](bytes.NewReader(data), int64(len(data)))
+	assert.NoError(err)
+	assert.Nil(cr.Get(0))
+	assert.ErrorIs(cr.Err(), ErrSSTableCorrupt)
+	it = cr.Iter()
+	assert.False(it.Next())
+	assert.ErrorIs(it.Err(), ErrSSTableCorrupt)
+	_, err = NewReader[int](bytes.NewReader(data[:len(data)-1]), int64(len(data)-1))
+	assert.ErrorIs(err, ErrSSTableCorrupt)
+	data[len(data)-sstFooterSize-8] ^= 0xff // in the bloom block
+	_, err = NewReader[int](bytes.NewReader(data), int64(len(data)))
+	assert.ErrorIs(err, ErrSSTableCorrupt)
+
+	// the index with too many blocks
+	buf.Reset()
+	sw := &sstWriter{w: bufio.NewWriter(&buf)}
+	sw.writeBlock(binary.AppendUvarint(nil, 1<<62))
+	var footer [sstFooterSize]byte
+	binary.LittleEndian.PutUint64(footer[8:], uint64(sw.off-4))
+	binary.LittleEndian.PutUint64(footer[40:], sstMagic)
+	sw.write(footer[:])
+	sw.w.Flush()
+	_, err = NewReader[int](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.ErrorIs(err, ErrSSTableCorrupt)
+
+	// not encodable
+	tree.Put(1, func() {})
+	assert.Error(tree.WriteSSTable(&buf, SSTableOptions{}))
+}
+
+func assertKeyCodec[K constraints.Ordered](assert *assert.Assertions, keys []K) {
+	for _, k := range keys {
+		name, err := sstDecodeKey[K](sstKey(k))
+		assert.NoError(err)
+		assert.Equal(k, name)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	title("Test bloomFilter")
+	assert := assert.New(t)
+
+	f := newBloomFilter(1000, 10)
+	for i := 0; i < 1000; i++ {
+		f.add([]byte(fmt.Sprint(i)))
+	}
+	var fp int
+	for i := 0; i < 100000; i++ {
+		assert.True(i >= 1000 || f.has([]byte(fmt.Sprint(i))))
+		if i >= 1000 && f.has([]byte(fmt.Sprint(i))) {
+			fp++
+		}
+	}
+	assert.Less(fp, 3000) // about 1% expected
+}
@@ -0,0 +1,241 @@
+package gomapllrb
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+)
+
+// WriteSVG writes the tree structure as a standalone SVG picture. The nodes
+// are laid out in the key order from left to right, and hovering a node
+// shows its value and the stats of its subtree.
+//
+//	tree.WriteSVG(f, ViewOptions[string]{MaxDepth: 8})
+func (tree *Tree[K]) WriteSVG(w io.Writer, opts ViewOptions[K]) error {
+	var buf bytes.Buffer
+	tree.mutex.RLock()
+	tree.writeSVG(&buf, opts)
+	tree.mutex.RUnlock()
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteHTML writes the tree structure as a standalone HTML page with the
+// picture of WriteSVG(). Clicking a node collapses or expands its subtree.
+func (tree *Tree[K]) WriteHTML(w io.Writer, opts ViewOptions[K]) error {
+	var buf bytes.Buffer
+	buf.WriteString(svgHTMLHead)
+	tree.mutex.RLock()
+	tree.writeSVG(&buf, opts)
+	tree.mutex.RUnlock()
+	buf.WriteString(svgHTMLTail)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+/*************************************************************************
+ * SVG functions
+ ************************************************************************/
+
+const (
+	svgRadius = 16 // min radius of the nodes
+	svgMargin = 20
+	svgYStep  = 60 // distance between the levels
+)
+
+// svgStat is the stats of a subtree shown in the tooltips.
+type svgStat struct {
+	size, height, blackHeight int
+}
+
+// writeSVG draws the tree. The caller must hold the read lock.
+func (tree *Tree[K]) writeSVG(buf *bytes.Buffer, opts ViewOptions[K]) {
+	nodes := tree.viewNodes(opts)
+	if len(nodes) == 0 {
+		fmt.Fprintf(buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\"></svg>\n",
+			2*svgMargin, 2*svgMargin)
+		return
+	}
+
+	// the children of the nodes in the view, -1 for none
+	left := make([]int, len(nodes))
+	right := make([]int, len(nodes))
+	for i := range nodes {
+		left[i], right[i] = -1, -1
+	}
+	radius := svgRadius
+	for _, v := range nodes {
+		if v.node == nil && !v.more {
+			continue // the placeholders don't take a slot
+		}
+		if v.node != nil {
+			if r := 4*len(viewLabel(v.node, false, "")) + 8; r > radius {
+				radius = r
+			}
+		}
+		if v.parent < 0 {
+			continue
+		}
+		if v.right {
+			right[v.parent] = v.id
+		} else {
+			left[v.parent] = v.id
+		}
+	}
+
+	// in-order slots give the x positions
+	slots := make([]int, len(nodes))
+	num, height := 0, 0
+	var stack []int
+	for i := 0; i >= 0 || len(stack) > 0; {
+		for ; i >= 0; i = left[i] {
+			stack = append(stack, i)
+		}
+		i = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		slots[i] = num
+		num++
+		if nodes[i].depth+1 > height {
+			height = nodes[i].depth + 1
+		}
+		i = right[i]
+	}
+
+	xstep := 2*radius + 8
+	x := func(i int) int { return svgMargin + radius + slots[i]*xstep }
+	y := func(i int) int { return svgMargin + radius + nodes[i].depth*svgYStep }
+	width := 2*svgMargin + num*xstep
+	depth := 2*svgMargin + 2*radius + (height-1)*svgYStep
+	if opts.Values {
+		depth += 20
+	}
+	fmt.Fprintf(buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n",
+		width, depth)
+	buf.WriteString("<style>\n" +
+		".edge { stroke: #222; stroke-width: 1.5; }\n" +
+		".edge.red { stroke: #d22; stroke-width: 3; }\n" +
+		".node circle { fill: #222; stroke: #222; stroke-width: 2; }\n" +
+		".node.red circle { fill: #d22; stroke: #d22; }\n" +
+		".node.collapsed circle { stroke: #fc0; stroke-width: 4; }\n" +
+		".node text { fill: #fff; text-anchor: middle; dominant-baseline: central; }\n" +
+		".node text.value, .node.more text { fill: #222; }\n" +
+		"</style>\n")
+
+	for _, v := range nodes {
+		if v.parent < 0 || (v.node == nil && !v.more) {
+			continue
+		}
+		class := "edge"
+		if v.node != nil && v.node.red {
+			class += " red"
+		}
+		fmt.Fprintf(buf, "<line class=\"%s\" data-node=\"n%d\" x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\"/>\n",
+			class, v.id, x(v.parent), y(v.parent), x(v.id), y(v.id))
+	}
+
+	stats := tree.svgStats(tree.viewTop(opts))
+	for _, v := range nodes {
+		if v.node == nil && !v.more {
+			continue
+		}
+		up := ""
+		if v.parent >= 0 {
+			up = fmt.Sprintf("n%d", v.parent)
+		}
+		if v.more {
+			fmt.Fprintf(buf, "<g class=\"node more\" id=\"n%d\" data-up=\"%s\"><text x=\"%d\" y=\"%d\">...</text></g>\n",
+				v.id, up, x(v.id), y(v.id))
+			continue
+		}
+
+		class := "node"
+		if v.node.red {
+			class += " red"
+		}
+		s := stats[v.node]
+		tip := fmt.Sprintf("key: %v\nvalue: %v\nsize: %d, height: %d, black height: %d",
+			v.node.name, v.node.data, s.size, s.height, s.blackHeight)
+		fmt.Fprintf(buf, "<g class=\"%s\" id=\"n%d\" data-up=\"%s\"><title>%s</title>", class, v.id, up, html.EscapeString(tip))
+		fmt.Fprintf(buf, "<circle cx=\"%d\" cy=\"%d\" r=\"%d\"/>", x(v.id), y(v.id), radius)
+		fmt.Fprintf(buf, "<text x=\"%d\" y=\"%d\">%s</text>", x(v.id), y(v.id), html.EscapeString(viewLabel(v.node, false, "")))
+		if opts.Values {
+			fmt.Fprintf(buf, "<text class=\"value\" x=\"%d\" y=\"%d\">%s</text>",
+				x(v.id), y(v.id)+radius+10, html.EscapeString(fmt.Sprintf("%v", v.node.data)))
+		}
+		buf.WriteString("</g>\n")
+	}
+	buf.WriteString("</svg>\n")
+}
+
+// svgStats computes the stats of all the subtrees under the top, children
+// first by walking the pre-order backwards.
+func (tree *Tree[K]) svgStats(top *Node[K]) map[*Node[K]]svgStat {
+	var order []*Node[K]
+	stack := []*Node[K]{top}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		order = append(order, node)
+		stack = append(stack, node.left, node.right)
+	}
+
+	stats := make(map[*Node[K]]svgStat, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		node := order[i]
+		l, r := stats[node.left], stats[node.right]
+		s := svgStat{
+			size:        1 + l.size + r.size,
+			height:      1 + max(l.height, r.height),
+			blackHeight: l.blackHeight,
+		}
+		if !node.red {
+			s.blackHeight++
+		}
+		stats[node] = s
+	}
+	return stats
+}
+
+const svgHTMLHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>LLRB tree</title>
+<style>
+body { font-family: sans-serif; }
+.node { cursor: pointer; }
+</style>
+</head>
+<body>
+`
+
+const svgHTMLTail = `<script>
+var nodes = document.querySelectorAll("g.node");
+var edges = document.querySelectorAll("line.edge");
+var up = {}, collapsed = {};
+function hidden(id) {
+  for (var p = up[id]; p; p = up[p]) {
+    if (collapsed[p]) return true;
+  }
+  return false;
+}
+function update() {
+  nodes.forEach(function(g) { g.style.display = hidden(g.id) ? "none" : ""; });
+  edges.forEach(function(e) { e.style.display = hidden(e.getAttribute("data-node")) ? "none" : ""; });
+}
+nodes.forEach(function(g) {
+  up[g.id] = g.getAttribute("data-up");
+  g.addEventListener("click", function() {
+    collapsed[g.id] = !collapsed[g.id];
+    g.classList.toggle("collapsed", collapsed[g.id]);
+    update();
+  });
+});
+</script>
+</body>
+</html>
+`
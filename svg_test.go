@@ -0,0 +1,82 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSVG(t *testing.T) {
+	title("Test WriteSVG() and WriteHTML()")
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	tree := New[string]()
+	assert.NoError(tree.WriteSVG(&buf, ViewOptions[string]{}))
+	assert.Equal("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"40\" height=\"40\"></svg>\n", buf.String())
+
+	//  ┌───C
+	//  B
+	//  └───A
+	//      └──[<]
+	for _, k := range []string{"A", "B", "C", "<"} {
+		tree.Put(k, k+"&")
+	}
+	buf.Reset()
+	assert.NoError(tree.WriteSVG(&buf, ViewOptions[string]{Values: true}))
+	svg := buf.String()
+	assert.True(strings.HasPrefix(svg, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"200\" height=\"212\""))
+	assert.True(strings.HasSuffix(svg, "</svg>\n"))
+	assert.Equal(4, strings.Count(svg, "<circle "))
+	assert.Equal(3, strings.Count(svg, "<line "))
+	assert.Equal(1, strings.Count(svg, "<line class=\"edge red\""))
+
+	// laid out in the key order
+	assert.Contains(svg, "<g class=\"node red\" id=\"n2\" data-up=\"n1\"><title>key: &lt;\n"+
+		"value: &lt;&amp;\n"+
+		"size: 1, height: 1, black height: 0</title><circle cx=\"36\" cy=\"156\" r=\"16\"/>")
+	assert.Contains(svg, "<g class=\"node\" id=\"n1\" data-up=\"n0\"><title>key: A\n"+
+		"value: A&amp;\n"+
+		"size: 2, height: 2, black height: 1</title><circle cx=\"76\" cy=\"96\" r=\"16\"/>")
+	assert.Contains(svg, "<g class=\"node\" id=\"n0\" data-up=\"\"><title>key: B\n"+
+		"value: B&amp;\n"+
+		"size: 4, height: 3, black height: 2</title><circle cx=\"116\" cy=\"36\" r=\"16\"/>")
+	assert.Contains(svg, "<circle cx=\"156\" cy=\"96\" r=\"16\"/><text x=\"156\" y=\"96\">C</text>"+
+		"<text class=\"value\" x=\"156\" y=\"122\">C&amp;</text></g>")
+
+	// truncated
+	buf.Reset()
+	assert.NoError(tree.WriteSVG(&buf, ViewOptions[string]{MaxDepth: 1}))
+	svg = buf.String()
+	assert.Equal(1, strings.Count(svg, "<circle "))
+	assert.Contains(svg, "<g class=\"node more\" id=\"n1\" data-up=\"n0\"><text x=\"36\" y=\"96\">...</text></g>")
+
+	// the page embeds the picture
+	buf.Reset()
+	assert.NoError(tree.WriteHTML(&buf, ViewOptions[string]{}))
+	page := buf.String()
+	assert.True(strings.HasPrefix(page, "<!DOCTYPE html>"))
+	assert.Equal(4, strings.Count(page, "<circle "))
+	assert.Contains(page, "<script>")
+
+	// a big tree is laid out without overlaps
+	numbers := New[int]()
+	for i := 0; i < 1000; i++ {
+		numbers.Put(int(hash32(i)), nil)
+	}
+	buf.Reset()
+	assert.NoError(numbers.WriteSVG(&buf, ViewOptions[int]{}))
+	assert.Equal(numbers.Len(), strings.Count(buf.String(), "<circle "))
+	xs := map[string]bool{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if i := strings.Index(line, "<circle cx=\""); i >= 0 {
+			x := strings.SplitN(line[i+12:], "\"", 2)[0]
+			assert.False(xs[x])
+			xs[x] = true
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package gomapllrb
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+
+	"golang.org/x/exp/constraints"
+)
+
+// TraceOp is the type of a step traced by SetTracer().
+type TraceOp int
+
+const (
+	// TracePut starts the steps of a Put().
+	TracePut TraceOp = iota
+	// TraceDelete starts the steps of a Delete(), including the deletions
+	// by expiration and eviction.
+	TraceDelete
+	// TraceRotateLeft is a left rotation of the node.
+	TraceRotateLeft
+	// TraceRotateRight is a right rotation of the node.
+	TraceRotateRight
+	// TraceFlipColor is a color flip of the node and its children.
+	TraceFlipColor
+	// TraceMoveRedLeft starts moving a red link down to the left.
+	TraceMoveRedLeft
+	// TraceMoveRedRight starts moving a red link down to the right.
+	TraceMoveRedRight
+	// TraceDeleteMin starts deleting the min node of the subtree, which
+	// replaces the deleted key found in the middle of the tree.
+	TraceDeleteMin
+)
+
+var traceOpNames = [...]string{
+	TracePut:          "Put",
+	TraceDelete:       "Delete",
+	TraceRotateLeft:   "RotateLeft",
+	TraceRotateRight:  "RotateRight",
+	TraceFlipColor:    "FlipColor",
+	TraceMoveRedLeft:  "MoveRedLeft",
+	TraceMoveRedRight: "MoveRedRight",
+	TraceDeleteMin:    "DeleteMin",
+}
+
+func (op TraceOp) String() string {
+	if op < 0 || int(op) >= len(traceOpNames) {
+		return fmt.Sprintf("TraceOp(%d)", int(op))
+	}
+	return traceOpNames[op]
+}
+
+// TraceEvent is a step of the tree operations delivered to the tracer.
+//
+// Snapshot is the drawing of the tree like String(), taken after the step.
+// The steps starting a sequence of other steps, such as TracePut and
+// TraceMoveRedLeft, are delivered before the sequence, so the snapshot is
+// taken before the step. The root may be red in the snapshots since it's
+// blackened at the end of the operation.
+type TraceEvent[K constraints.Ordered] struct {
+	Op       TraceOp
+	Key      K      // key of the operation or the node the step applied to
+	Snapshot string // empty unless the snapshots are enabled
+}
+
+// SetTracer sets a function receiving the steps of the tree operations.
+// If snapshot is true, each event has a drawing of the whole tree, which
+// makes every step O(n) so it's only for the small trees. The function is
+// called under the write lock, so it must not call back into the tree.
+// Set nil to stop tracing.
+//
+//	rec := &TraceRecorder[string]{}
+//	tree.SetTracer(rec.Record, true)
+//	tree.Put("A", nil)
+//	rec.WriteText(os.Stdout)
+func (tree *Tree[K]) SetTracer(fn func(ev TraceEvent[K]), snapshot bool) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	if fn == nil {
+		tree.trace = nil
+		return
+	}
+	tree.trace = &tracer[K]{fn: fn, snapshot: snapshot}
+}
+
+// TraceRecorder collects the traced steps and renders them frame by frame.
+// Use Record() as the tracer function.
+type TraceRecorder[K constraints.Ordered] struct {
+	Events []TraceEvent[K]
+}
+
+// Record appends the event.
+func (r *TraceRecorder[K]) Record(ev TraceEvent[K]) {
+	r.Events = append(r.Events, ev)
+}
+
+// Reset clears the events recorded.
+func (r *TraceRecorder[K]) Reset() {
+	r.Events = nil
+}
+
+// WriteText writes the steps recorded as text frames.
+//
+//	#2 Put B
+//	A
+//
+//	#3 RotateLeft A
+//	B
+//	└──[A]
+func (r *TraceRecorder[K]) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	for i, ev := range r.Events {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "#%d %v %v\n", i+1, ev.Op, ev.Key)
+		buf.WriteString(ev.Snapshot)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteHTML writes the steps recorded as a standalone HTML page, which
+// plays the frames with the buttons or the arrow keys.
+func (r *TraceRecorder[K]) WriteHTML(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString(traceHTMLHead)
+	for i, ev := range r.Events {
+		fmt.Fprintf(&buf, "<div class=\"frame\" id=\"f%d\"><h2>#%d %s</h2><pre>%s</pre></div>\n",
+			i, i+1, html.EscapeString(fmt.Sprintf("%v %v", ev.Op, ev.Key)),
+			html.EscapeString(ev.Snapshot))
+	}
+	buf.WriteString(traceHTMLTail)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+/*************************************************************************
+ * Tracing functions
+ ************************************************************************/
+
+type tracer[K constraints.Ordered] struct {
+	fn       func(ev TraceEvent[K])
+	snapshot bool
+}
+
+// traceStep delivers a step. The callers check tree.trace first to keep
+// the cost off when tracing is disabled.
+func (tree *Tree[K]) traceStep(op TraceOp, name K) {
+	ev := TraceEvent[K]{Op: op, Key: name}
+	if tree.trace.snapshot {
+		var buf bytes.Buffer
+		printNode(tree.root, &buf)
+		ev.Snapshot = buf.String()
+	}
+	tree.trace.fn(ev)
+}
+
+const traceHTMLHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>LLRB trace</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; font-size: 14px; line-height: 1.2; }
+.frame { display: none; }
+.frame.on { display: block; }
+</style>
+</head>
+<body>
+<div>
+<button onclick="show(0)">&laquo;</button>
+<button onclick="show(cur-1)">&lsaquo; Prev</button>
+<button onclick="show(cur+1)">Next &rsaquo;</button>
+<button onclick="show(frames.length-1)">&raquo;</button>
+<button onclick="play()">Play</button>
+</div>
+`
+
+const traceHTMLTail = `<script>
+var frames = document.getElementsByClassName("frame");
+var cur = 0, timer = null;
+function show(i) {
+  if (i < 0 || i >= frames.length) return;
+  frames[cur].classList.remove("on");
+  frames[i].classList.add("on");
+  cur = i;
+}
+function play() {
+  if (timer) { clearInterval(timer); timer = null; return; }
+  timer = setInterval(function() {
+    if (cur + 1 >= frames.length) { clearInterval(timer); timer = null; return; }
+    show(cur + 1);
+  }, 800);
+}
+document.onkeydown = function(e) {
+  if (e.key == "ArrowLeft") show(cur - 1);
+  if (e.key == "ArrowRight") show(cur + 1);
+};
+if (frames.length > 0) show(0);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,84 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracer(t *testing.T) {
+	title("Test SetTracer()")
+	assert := assert.New(t)
+
+	tree := New[string]()
+	rec := &TraceRecorder[string]{}
+	tree.SetTracer(rec.Record, true)
+	for _, k := range []string{"A", "B", "C"} {
+		tree.Put(k, nil)
+	}
+	tree.Delete("B")
+	if LLRB234 {
+		var ops []string
+		for _, ev := range rec.Events {
+			ops = append(ops, ev.Op.String()+" "+ev.Key)
+		}
+		assert.Equal([]string{
+			"Put A", "Put B", "RotateLeft A", "Put C",
+			"Delete B", "RotateRight B", "DeleteMin C", "RotateLeft A",
+		}, ops)
+
+		var buf bytes.Buffer
+		assert.NoError(rec.WriteText(&buf))
+		assert.True(strings.HasPrefix(buf.String(), ""+
+			"#1 Put A\n"+
+			"\n"+
+			"#2 Put B\n"+
+			"A \n"+
+			"\n"+
+			"#3 RotateLeft A\n"+
+			"B \n"+
+			"└──[A]\n"+
+			"\n"))
+		assert.True(strings.HasSuffix(buf.String(), ""+
+			"#8 RotateLeft A\n"+
+			"C \n"+
+			"└──[A]\n"))
+
+		buf.Reset()
+		assert.NoError(rec.WriteHTML(&buf))
+		assert.Equal(8, strings.Count(buf.String(), `<div class="frame"`))
+		assert.Contains(buf.String(), "<h2>#3 RotateLeft A</h2><pre>B \n└──[A]\n</pre>")
+	}
+
+	// the steps are counted as the perf stats
+	tree.SetTracer(nil, false)
+	rec.Reset()
+	tree.SetTracer(rec.Record, false)
+	tree.ResetStats()
+	for i := 0; i < 1000; i++ {
+		tree.Put(string(rune('A'+hash32(i)%64)), nil)
+		tree.Delete(string(rune('A' + hash32(i+1)%64)))
+	}
+	counts := map[TraceOp]uint64{}
+	for _, ev := range rec.Events {
+		assert.Empty(ev.Snapshot)
+		counts[ev.Op]++
+	}
+	stats := tree.Stats()
+	assert.Equal(stats.Put.Sum, counts[TracePut])
+	assert.Equal(stats.Delete.Sum, counts[TraceDelete])
+	assert.Equal(stats.Perf.Rotate.Left, counts[TraceRotateLeft])
+	assert.Equal(stats.Perf.Rotate.Right, counts[TraceRotateRight])
+	assert.Equal(stats.Perf.Flip, counts[TraceFlipColor])
+
+	// stop tracing
+	tree.SetTracer(nil, false)
+	rec.Reset()
+	tree.Put("Z", nil)
+	assert.Empty(rec.Events)
+	assert.Equal("TraceOp(100)", TraceOp(100).String())
+}
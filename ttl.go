@@ -0,0 +1,206 @@
+package gomapllrb
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/constraints"
+)
+
+// PutWithTTL inserts or replaces the key which expires after the ttl.
+// The expired keys are invisible to Get, Exist and iterators right away,
+// but they are removed from the tree and counted in Len until the next
+// write operation, Expire() call or janitor run. Writing the key again
+// without TTL clears it.
+func (tree *Tree[K]) PutWithTTL(name K, data interface{}, ttl time.Duration) {
+	defer tree.unlock(opPut, name, tree.lock())
+	tree.putLocked(name, data)
+	// by the key kept, which may differ from the one equal to it
+	if node := tree.lookup(name); node != nil {
+		tree.ttlIndex().set(node.name, ttl)
+	}
+}
+
+// TTL returns the remaining time to live of the key.
+// It returns false if the key is not found or has no TTL.
+func (tree *Tree[K]) TTL(name K) (time.Duration, bool) {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	if tree.ttl == nil {
+		return 0, false
+	}
+	node := tree.find(tree.root, name)
+	if node == nil {
+		return 0, false
+	}
+	i, ok := tree.ttl.expires[node.name]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(tree.ttl.queue[i].at - tree.ttl.now().UnixNano()), true
+}
+
+// Expire removes the expired keys now. It returns the number of keys removed.
+func (tree *Tree[K]) Expire() int {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	if tree.ttl == nil {
+		return 0
+	}
+	return tree.expireLocked()
+}
+
+// StartJanitor starts a goroutine which removes the expired keys on every
+// interval. It returns a function to stop the goroutine. No goroutine is
+// started if the interval is not positive.
+func (tree *Tree[K]) StartJanitor(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				tree.Expire()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// SetClock sets the clock function used for the expiration. (default: time.Now)
+func (tree *Tree[K]) SetClock(fn func() time.Time) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.ttlIndex().now = fn
+}
+
+// OnExpire sets a callback function called when an expired key is removed.
+// The callback is called under the write lock, so it must not access the tree.
+func (tree *Tree[K]) OnExpire(fn func(name K, data interface{})) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.ttlIndex().onExpire = fn
+}
+
+/*************************************************************************
+ * Expiration index
+ ************************************************************************/
+
+// ttlIndex keeps the keys with TTL in a time ordered queue, so the expired
+// keys can be found without walking the tree. The queue is a heap indexed
+// by the keys, so refreshing or removing a key updates its entry in place.
+// The keys are the ones kept in the nodes, since the map takes the keys
+// equal by a custom comparator as different.
+type ttlIndex[K constraints.Ordered] struct {
+	now      func() time.Time
+	onExpire func(name K, data interface{})
+	expires  map[K]int // position of the keys in the queue
+	queue    []expireEntry[K]
+}
+
+type expireEntry[K constraints.Ordered] struct {
+	name K
+	at   int64 // expiration time in unix nano
+}
+
+func (tree *Tree[K]) ttlIndex() *ttlIndex[K] {
+	if tree.ttl == nil {
+		tree.ttl = &ttlIndex[K]{
+			now:     time.Now,
+			expires: make(map[K]int),
+		}
+	}
+	return tree.ttl
+}
+
+// isExpired checks if the key has expired. The caller must hold the lock.
+func (tree *Tree[K]) isExpired(name K) bool {
+	if tree.ttl == nil || len(tree.ttl.expires) == 0 {
+		return false
+	}
+	i, ok := tree.ttl.expires[name]
+	return ok && tree.ttl.queue[i].at <= tree.ttl.now().UnixNano()
+}
+
+// expireLocked removes the expired keys. The caller must hold the write lock.
+func (tree *Tree[K]) expireLocked() int {
+	ttl := tree.ttl
+	if len(ttl.queue) == 0 {
+		return 0
+	}
+	num := 0
+	now := ttl.now().UnixNano()
+	for len(ttl.queue) > 0 && ttl.queue[0].at <= now {
+		name := ttl.queue[0].name
+		data, ok := tree.remove(name) // unsets the TTL too
+		if !ok {
+			ttl.unset(name)
+			continue
+		}
+		tree.stats.Expired++
+		num++
+		if ttl.onExpire != nil {
+			ttl.onExpire(name, data)
+		}
+	}
+	return num
+}
+
+func (ttl *ttlIndex[K]) set(name K, duration time.Duration) {
+	at := ttl.now().Add(duration).UnixNano()
+	if i, ok := ttl.expires[name]; ok {
+		ttl.queue[i].at = at
+		heap.Fix(ttl, i)
+		return
+	}
+	heap.Push(ttl, expireEntry[K]{name: name, at: at})
+}
+
+func (ttl *ttlIndex[K]) unset(name K) {
+	if i, ok := ttl.expires[name]; ok {
+		heap.Remove(ttl, i)
+	}
+}
+
+func (ttl *ttlIndex[K]) reset() {
+	ttl.expires = make(map[K]int)
+	ttl.queue = nil
+}
+
+// heap.Interface of the queue, keeping the positions in expires.
+
+func (ttl *ttlIndex[K]) Len() int           { return len(ttl.queue) }
+func (ttl *ttlIndex[K]) Less(i, j int) bool { return ttl.queue[i].at < ttl.queue[j].at }
+
+func (ttl *ttlIndex[K]) Swap(i, j int) {
+	q := ttl.queue
+	q[i], q[j] = q[j], q[i]
+	ttl.expires[q[i].name] = i
+	ttl.expires[q[j].name] = j
+}
+
+func (ttl *ttlIndex[K]) Push(x interface{}) {
+	e := x.(expireEntry[K])
+	ttl.expires[e.name] = len(ttl.queue)
+	ttl.queue = append(ttl.queue, e)
+}
+
+func (ttl *ttlIndex[K]) Pop() interface{} {
+	q := ttl.queue
+	e := q[len(q)-1]
+	var zero expireEntry[K]
+	q[len(q)-1] = zero // drop the key for the GC
+	ttl.queue = q[:len(q)-1]
+	delete(ttl.expires, e.name)
+	return e
+}
@@ -0,0 +1,146 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"cmp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTL(t *testing.T) {
+	title("Test TTL")
+	assert := assert.New(t)
+
+	now := time.Unix(1000, 0)
+	tree := New[int]()
+	tree.SetClock(func() time.Time { return now })
+	var expired []int
+	tree.OnExpire(func(name int, data interface{}) {
+		assert.Equal(name*10, data)
+		expired = append(expired, name)
+	})
+
+	tree.Put(1, 10)
+	tree.PutWithTTL(2, 20, time.Second)
+	tree.PutWithTTL(3, 30, 2*time.Second)
+	tree.PutWithTTL(4, 40, 3*time.Second)
+	tree.Put(4, 40) // clears TTL
+	ttl, ok := tree.TTL(2)
+	assert.True(ok)
+	assert.Equal(time.Second, ttl)
+	_, ok = tree.TTL(1)
+	assert.False(ok)
+	_, ok = tree.TTL(4)
+	assert.False(ok)
+
+	// lazy expiration on reads
+	now = now.Add(time.Second)
+	assert.Nil(tree.Get(2))
+	assert.False(tree.Exist(2))
+	assert.True(tree.Exist(3))
+	keys := []int{}
+	for it := tree.Iter(); it.Next(); {
+		keys = append(keys, it.Key())
+	}
+	assert.Equal([]int{1, 3, 4}, keys)
+	assert.Equal(4, tree.Len())
+	assert.Empty(expired)
+
+	// removed on the next write
+	tree.Put(5, 50)
+	assert.Equal([]int{2}, expired)
+	assert.Equal(4, tree.Len())
+	assertTreeCheck(t, tree, false)
+
+	// explicit expiration
+	now = now.Add(time.Hour)
+	assert.Equal(1, tree.Expire())
+	assert.Equal([]int{2, 3}, expired)
+	assert.Equal(0, tree.Expire())
+	assert.Equal(3, tree.Len())
+	assert.Equal(uint64(2), tree.Stats().Expired)
+	assert.Equal(uint64(0), tree.Stats().Delete.Deleted)
+
+	// overwritten TTL is updated in place
+	for i := 0; i < 100; i++ {
+		tree.PutWithTTL(6, 60, time.Second)
+	}
+	tree.PutWithTTL(6, 60, time.Minute)
+	assert.Equal(1, len(tree.ttl.queue))
+	now = now.Add(time.Second)
+	assert.Equal(0, tree.Expire())
+	assert.True(tree.Exist(6))
+
+	// the getters skip the expired keys
+	tree.PutWithTTL(0, 0, time.Second)
+	tree.PutWithTTL(9, 90, time.Second)
+	tree.PutWithTTL(5, 50, time.Second)
+	now = now.Add(time.Second)
+	k, _, ok := tree.Min()
+	assert.Equal([]interface{}{1, true}, []interface{}{k, ok})
+	k, _, ok = tree.Max()
+	assert.Equal([]interface{}{6, true}, []interface{}{k, ok})
+	k, _, _ = tree.Bigger(4)
+	assert.Equal(6, k)
+	k, _, _ = tree.EqualOrBigger(5)
+	assert.Equal(6, k)
+	k, _, _ = tree.Smaller(6)
+	assert.Equal(4, k)
+	k, _, _ = tree.EqualOrSmaller(5)
+	assert.Equal(4, k)
+	_, _, ok = tree.Bigger(6)
+	assert.False(ok)
+	assert.Equal(3, tree.Expire())
+	assert.Equal(1, len(tree.ttl.queue)) // 6 in a minute
+
+	// delete and clear
+	tree.PutWithTTL(7, 70, time.Second)
+	tree.Delete(7)
+	tree.Clear()
+	now = now.Add(time.Hour)
+	assert.Equal(0, tree.Expire())
+	assert.Equal(0, tree.Len())
+
+	// the keys equal by the comparator
+	strs := New[string]()
+	strs.SetCompare(func(a, b string) int { return cmp.Compare(strings.ToLower(a), strings.ToLower(b)) })
+	strs.SetClock(func() time.Time { return now })
+	strs.PutWithTTL("Key", 1, time.Second)
+	ttl, ok = strs.TTL("KEY")
+	assert.True(ok)
+	assert.Equal(time.Second, ttl)
+	strs.Put("KEY", 2) // clears TTL
+	_, ok = strs.TTL("key")
+	assert.False(ok)
+	strs.PutWithTTL("key", 3, time.Second)
+	strs.Delete("KEY")
+	strs.Put("kEY", 4)
+	now = now.Add(time.Second)
+	assert.Equal(0, strs.Expire())
+	assert.Equal(4, strs.Get("key"))
+	assert.Empty(strs.ttl.queue)
+}
+
+func TestTTLJanitor(t *testing.T) {
+	title("Test TTL janitor")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	for i := 0; i < 100; i++ {
+		tree.PutWithTTL(i, i, time.Millisecond)
+	}
+	stop := tree.StartJanitor(time.Millisecond)
+	defer stop()
+	assert.Eventually(func() bool {
+		return tree.Len() == 0
+	}, time.Second, time.Millisecond)
+	assertTreeCheck(t, tree, false)
+	stop()
+
+	// disabled
+	tree.StartJanitor(0)()
+}
@@ -0,0 +1,144 @@
+package gomapllrb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"golang.org/x/exp/constraints"
+)
+
+// The violations found by Check() and Validate(). Use errors.Is() to tell
+// them apart.
+var (
+	ErrRootProperty   = errors.New("root property violation found")
+	ErrRedProperty    = errors.New("red property violation found")
+	ErrBlackProperty  = errors.New("black property violation found")
+	ErrLLRBProperty   = errors.New("LLRB property violation found")
+	ErrHeightProperty = errors.New("height property violation found")
+	ErrOrder          = errors.New("key order violation found")
+	ErrParentLink     = errors.New("parent link violation found")
+	ErrLength         = errors.New("length mismatch found")
+)
+
+// ValidationError is the error returned by Validate(). It has the key of
+// the offending node and the keys on the path from the root to it.
+//
+//	var verr *ValidationError[string]
+//	if errors.As(err, &verr) {
+//	  fmt.Println(verr.Key, verr.Path)
+//	}
+type ValidationError[K constraints.Ordered] struct {
+	Err  error // one of the Err* violations
+	Key  K     // key of the offending node
+	Path []K   // keys from the root to the offending node
+}
+
+func (e *ValidationError[K]) Error() string {
+	return fmt.Sprintf("%v at key %v, path %v", e.Err, e.Key, e.Path)
+}
+
+func (e *ValidationError[K]) Unwrap() error {
+	return e.Err
+}
+
+// Validate is a comprehensive version of Check(). In addition to the
+// red-black tree properties, it verifies the key order under the active
+// comparator, the parent links and the number of objects. The error tells
+// the offending key and the path to it as a *ValidationError, except for
+// the length mismatch.
+func (tree *Tree[K]) Validate() error {
+	tree.mutex.RLock()
+	defer tree.mutex.RUnlock()
+	return tree.validate()
+}
+
+func (tree *Tree[K]) validate() error {
+	root := tree.root
+	if isRed(root) {
+		return newValidationError(ErrRootProperty, []*Node[K]{root})
+	}
+	if root != nil && root.up != nil {
+		return newValidationError(ErrParentLink, []*Node[K]{root})
+	}
+
+	length := 0
+	for node := root; node != nil; node = node.left {
+		if !isRed(node) {
+			length++
+		}
+	}
+
+	// the keys of a subtree are bounded by its ancestors, lo < key < hi
+	type frameObj struct {
+		node   *Node[K]
+		depth  int
+		blacks int
+		lo, hi *Node[K]
+	}
+	var path []*Node[K]
+	num, height := 0, 0
+	stack := append(make([]frameObj, 0, 64), frameObj{node: root})
+	for len(stack) > 0 {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		path = path[:f.depth]
+		if f.node == nil {
+			if f.blacks != length {
+				return newValidationError(ErrBlackProperty, path)
+			}
+			continue
+		}
+
+		node := f.node
+		path = append(path, node)
+		num++
+		if f.depth+1 > height {
+			height = f.depth + 1
+		}
+		if f.depth > 0 && node.up != path[f.depth-1] {
+			return newValidationError(ErrParentLink, path)
+		}
+		if (f.lo != nil && tree.compare(f.lo.name, node.name) >= 0) ||
+			(f.hi != nil && tree.compare(node.name, f.hi.name) >= 0) {
+			return newValidationError(ErrOrder, path)
+		}
+		if isRed(node) && (isRed(node.right) || isRed(node.left)) {
+			return newValidationError(ErrRedProperty, path)
+		}
+		if isRed(node.right) && !isRed(node.left) {
+			return newValidationError(ErrLLRBProperty, path)
+		}
+
+		blacks := f.blacks
+		if !isRed(node) {
+			blacks++
+		}
+		stack = append(stack,
+			frameObj{node: node.left, depth: f.depth + 1, blacks: blacks, lo: f.lo, hi: node},
+			frameObj{node: node.right, depth: f.depth + 1, blacks: blacks, lo: node, hi: f.hi})
+	}
+
+	if num != tree.len {
+		return fmt.Errorf("%w: len %d, counted %d", ErrLength, tree.len, num)
+	}
+	if float64(height) > 2*math.Log2(float64(num+1)) {
+		return newValidationError(ErrHeightProperty, []*Node[K]{root})
+	}
+	return nil
+}
+
+// newValidationError makes an error of the last node on the path.
+func newValidationError[K constraints.Ordered](err error, path []*Node[K]) *ValidationError[K] {
+	e := &ValidationError[K]{
+		Err:  err,
+		Path: make([]K, len(path)),
+	}
+	for i, node := range path {
+		e.Path[i] = node.name
+	}
+	if len(path) > 0 {
+		e.Key = path[len(path)-1].name
+	}
+	return e
+}
@@ -0,0 +1,93 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	if !LLRB234 {
+		return
+	}
+	title("Test Validate()")
+	assert := assert.New(t)
+
+	// 2-3-4 LLRB will balance them as below
+	//      ┌──[5]
+	//  ┌───4
+	//  │   └──[3]
+	//  2
+	//  └───1
+	tree := New[int]()
+	assert.NoError(tree.Validate())
+	for _, k := range []int{1, 2, 3, 4, 5} {
+		tree.Put(k, nil)
+	}
+	assert.NoError(tree.Validate())
+
+	assertViolation := func(target error, key int, path []int) {
+		err := tree.Validate()
+		assert.ErrorIs(err, target)
+		var verr *ValidationError[int]
+		if assert.ErrorAs(err, &verr) {
+			assert.Equal(key, verr.Key)
+			assert.Equal(path, verr.Path)
+		}
+		// Check() reports the same kind of violations
+		if check := tree.Check(); check != nil {
+			assert.True(errors.Is(check, ErrRootProperty) || errors.Is(check, ErrRedProperty) ||
+				errors.Is(check, ErrBlackProperty) || errors.Is(check, ErrLLRBProperty))
+		}
+	}
+
+	tree.root.red = true
+	assertViolation(ErrRootProperty, 2, []int{2})
+	tree.root.red = false
+
+	tree.root.right.red = true
+	assertViolation(ErrLLRBProperty, 2, []int{2})
+	tree.root.left.red = true
+	assertViolation(ErrRedProperty, 4, []int{2, 4})
+	tree.root.left.red = false
+	tree.root.right.red = false
+
+	tree.root.right.right.red = false
+	assertViolation(ErrBlackProperty, 5, []int{2, 4, 5})
+	tree.root.right.right.red = true
+
+	tree.root.right.right.name = 0
+	assertViolation(ErrOrder, 0, []int{2, 4, 0})
+	tree.root.right.right.name = 5
+
+	tree.root.right.left.up = tree.root
+	assertViolation(ErrParentLink, 3, []int{2, 4, 3})
+	tree.root.right.left.up = tree.root.right
+
+	tree.len++
+	assert.ErrorIs(tree.Validate(), ErrLength)
+	assert.ErrorContains(tree.Validate(), "len 6, counted 5")
+	tree.len--
+	assert.NoError(tree.Validate())
+
+	// the order under a wrong comparator
+	tree.SetLess(func(a, b int) bool { return a > b })
+	assertViolation(ErrOrder, 4, []int{2, 4})
+	tree.SetLess(IsLess[int])
+	assert.NoError(tree.Validate())
+	assert.Contains(newValidationError(ErrOrder, []*Node[int]{tree.root}).Error(),
+		"key order violation found at key 2, path [2]")
+
+	// bigger tree with deletions
+	tree = New[int]()
+	for i := 0; i < 10000; i++ {
+		tree.Put(int(hash32(i)%5000), nil)
+		if i%3 == 0 {
+			tree.Delete(int(hash32(i/3) % 5000))
+		}
+	}
+	assert.NoError(tree.Validate())
+}
@@ -0,0 +1,239 @@
+package gomapllrb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/exp/constraints"
+)
+
+// ViewOptions configures the tree views such as WriteDOT(), WriteMermaid(),
+// WriteSVG() and Render(). The zero value draws the whole tree with the keys
+// only.
+type ViewOptions[K constraints.Ordered] struct {
+	Values   bool // show the values along with the keys
+	Parents  bool // draw the parent links too, only used by WriteDOT() and WriteMermaid()
+	MaxDepth int  // truncate the subtrees below this depth, 0 for unlimited
+	MaxNodes int  // max number of nodes to render, only used by Render()
+	Grouped  bool // render 2-3-4 tree nodes, only used by Render()
+
+	// Span limits the view to the subtree covering the keys from Start to
+	// End. The nodes out of the range are drawn only when they connect the
+	// nodes in the range.
+	Span  bool
+	Start K
+	End   K
+}
+
+// WriteDOT writes the tree structure in the Graphviz DOT language.
+//
+//	tree.WriteDOT(os.Stdout, ViewOptions[string]{Values: true})
+//	$ go run main.go | dot -Tsvg > tree.svg
+func (tree *Tree[K]) WriteDOT(w io.Writer, opts ViewOptions[K]) error {
+	tree.mutex.RLock()
+	nodes := tree.viewNodes(opts)
+	tree.mutex.RUnlock()
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph llrb {\n")
+	buf.WriteString("\tgraph [ordering=out];\n")
+	buf.WriteString("\tnode [shape=circle, style=filled, fontcolor=white, fillcolor=black];\n")
+	if opts.Values {
+		buf.WriteString("\tnode [shape=box, style=\"rounded,filled\"];\n")
+	}
+	for _, v := range nodes {
+		switch {
+		case v.more:
+			fmt.Fprintf(&buf, "\tn%d [label=\"...\", shape=plaintext, fontcolor=black, style=\"\"];\n", v.id)
+		case v.node == nil:
+			// keeps the only child on its side
+			fmt.Fprintf(&buf, "\tn%d [style=invis];\n", v.id)
+		default:
+			fmt.Fprintf(&buf, "\tn%d [label=\"%s\"", v.id, dotEscape(viewLabel(v.node, opts.Values, "\n")))
+			if v.node.red {
+				buf.WriteString(", fillcolor=red")
+			}
+			buf.WriteString("];\n")
+		}
+		if v.parent < 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "\tn%d -> n%d", v.parent, v.id)
+		switch {
+		case v.node == nil && !v.more:
+			buf.WriteString(" [style=invis]")
+		case v.node != nil && v.node.red:
+			buf.WriteString(" [color=red, penwidth=2]")
+		}
+		buf.WriteString(";\n")
+		if opts.Parents && v.node != nil {
+			fmt.Fprintf(&buf, "\tn%d -> n%d [style=dashed, color=gray, constraint=false];\n", v.id, v.parent)
+		}
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteMermaid writes the tree structure as a Mermaid flowchart, which can
+// be embedded in markdown documents.
+func (tree *Tree[K]) WriteMermaid(w io.Writer, opts ViewOptions[K]) error {
+	tree.mutex.RLock()
+	nodes := tree.viewNodes(opts)
+	tree.mutex.RUnlock()
+
+	var buf bytes.Buffer
+	var reds, blacks []string
+	var redLinks []string
+	links := 0
+	buf.WriteString("graph TD\n")
+	for _, v := range nodes {
+		if v.node == nil && !v.more {
+			continue // Mermaid doesn't keep the sides anyway
+		}
+		id := fmt.Sprintf("n%d", v.id)
+		if v.more {
+			fmt.Fprintf(&buf, "\t%s[\"...\"]\n", id)
+		} else {
+			fmt.Fprintf(&buf, "\t%s((\"%s\"))\n", id, mermaidEscape(viewLabel(v.node, opts.Values, "<br/>")))
+			if v.node.red {
+				reds = append(reds, id)
+			} else {
+				blacks = append(blacks, id)
+			}
+		}
+		if v.parent < 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "\tn%d --> %s\n", v.parent, id)
+		if v.node != nil && v.node.red {
+			redLinks = append(redLinks, fmt.Sprint(links))
+		}
+		links++
+		if opts.Parents && v.node != nil {
+			fmt.Fprintf(&buf, "\t%s -.-> n%d\n", id, v.parent)
+			links++
+		}
+	}
+	buf.WriteString("\tclassDef red fill:#d22,stroke:#d22,color:#fff\n")
+	buf.WriteString("\tclassDef black fill:#222,stroke:#222,color:#fff\n")
+	if len(reds) > 0 {
+		fmt.Fprintf(&buf, "\tclass %s red\n", strings.Join(reds, ","))
+	}
+	if len(blacks) > 0 {
+		fmt.Fprintf(&buf, "\tclass %s black\n", strings.Join(blacks, ","))
+	}
+	if len(redLinks) > 0 {
+		fmt.Fprintf(&buf, "\tlinkStyle %s stroke:#d22,stroke-width:2px\n", strings.Join(redLinks, ","))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+/*************************************************************************
+ * View functions
+ ************************************************************************/
+
+// viewNode is a node to draw. The node is nil for the markers.
+type viewNode[K constraints.Ordered] struct {
+	node   *Node[K]
+	id     int
+	parent int  // id of the parent, -1 for the top
+	depth  int  // depth from the top of the view
+	right  bool // right child of the parent
+	more   bool // marker of the truncated subtrees
+}
+
+// viewTop returns the top node of the view.
+func (tree *Tree[K]) viewTop(opts ViewOptions[K]) *Node[K] {
+	node := tree.root
+	for opts.Span && node != nil {
+		if tree.compare(node.name, opts.Start) < 0 {
+			node = node.right
+		} else if tree.compare(opts.End, node.name) < 0 {
+			node = node.left
+		} else {
+			break
+		}
+	}
+	return node
+}
+
+// viewNodes returns the nodes to draw in pre-order. A placeholder without
+// the node is added for the missing sibling of an only child, and a marker
+// with the more flag for the truncated subtrees.
+func (tree *Tree[K]) viewNodes(opts ViewOptions[K]) []viewNode[K] {
+	top := tree.viewTop(opts)
+	if top == nil {
+		return nil
+	}
+
+	var nodes []viewNode[K]
+	stack := []viewNode[K]{{node: top, parent: -1}}
+	for len(stack) > 0 {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		v.id = len(nodes)
+		nodes = append(nodes, v)
+		if v.node == nil {
+			continue
+		}
+
+		left, right := v.node.left, v.node.right
+		if opts.Span {
+			// drop the subtrees having no keys in the range
+			if !tree.inSpan(left, opts) {
+				left = nil
+			}
+			if !tree.inSpan(right, opts) {
+				right = nil
+			}
+		}
+		if left == nil && right == nil {
+			continue
+		}
+		if opts.MaxDepth > 0 && v.depth+1 >= opts.MaxDepth {
+			stack = append(stack, viewNode[K]{parent: v.id, depth: v.depth + 1, more: true})
+			continue
+		}
+		// push the right first to pop the left first
+		stack = append(stack,
+			viewNode[K]{node: right, parent: v.id, depth: v.depth + 1, right: true},
+			viewNode[K]{node: left, parent: v.id, depth: v.depth + 1})
+	}
+	return nodes
+}
+
+// inSpan checks if the subtree has any key in the range of the view.
+func (tree *Tree[K]) inSpan(node *Node[K], opts ViewOptions[K]) bool {
+	if node == nil {
+		return false
+	}
+	if tree.compare(node.name, opts.Start) < 0 {
+		// only the right subtree can have the keys in the range
+		n := tree.bigger(node.right, opts.Start, true)
+		return n != nil && tree.compare(n.name, opts.End) <= 0
+	}
+	if tree.compare(opts.End, node.name) < 0 {
+		n := tree.smaller(node.left, opts.End, true)
+		return n != nil && tree.compare(opts.Start, n.name) <= 0
+	}
+	return true
+}
+
+func viewLabel[K constraints.Ordered](node *Node[K], values bool, sep string) string {
+	if values {
+		return fmt.Sprintf("%v%s%v", node.name, sep, node.data)
+	}
+	return fmt.Sprintf("%v", node.name)
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;").Replace(s)
+}
@@ -0,0 +1,121 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDOT(t *testing.T) {
+	if !LLRB234 {
+		return
+	}
+	title("Test WriteDOT()")
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	tree := New[string]()
+	assert.NoError(tree.WriteDOT(&buf, ViewOptions[string]{}))
+	assert.Equal("digraph llrb {\n"+
+		"\tgraph [ordering=out];\n"+
+		"\tnode [shape=circle, style=filled, fontcolor=white, fillcolor=black];\n"+
+		"}\n", buf.String())
+
+	//  ┌───C
+	//  B
+	//  └───A
+	//      └──[0]
+	for _, k := range []string{"A", "B", "C", "0"} {
+		tree.Put(k, `"`+k+`"`)
+	}
+	buf.Reset()
+	assert.NoError(tree.WriteDOT(&buf, ViewOptions[string]{Values: true, Parents: true}))
+	assert.Equal("digraph llrb {\n"+
+		"\tgraph [ordering=out];\n"+
+		"\tnode [shape=circle, style=filled, fontcolor=white, fillcolor=black];\n"+
+		"\tnode [shape=box, style=\"rounded,filled\"];\n"+
+		"\tn0 [label=\"B\\n\\\"B\\\"\"];\n"+
+		"\tn1 [label=\"A\\n\\\"A\\\"\"];\n"+
+		"\tn0 -> n1;\n"+
+		"\tn1 -> n0 [style=dashed, color=gray, constraint=false];\n"+
+		"\tn2 [label=\"0\\n\\\"0\\\"\", fillcolor=red];\n"+
+		"\tn1 -> n2 [color=red, penwidth=2];\n"+
+		"\tn2 -> n1 [style=dashed, color=gray, constraint=false];\n"+
+		"\tn3 [style=invis];\n"+
+		"\tn1 -> n3 [style=invis];\n"+
+		"\tn4 [label=\"C\\n\\\"C\\\"\"];\n"+
+		"\tn0 -> n4;\n"+
+		"\tn4 -> n0 [style=dashed, color=gray, constraint=false];\n"+
+		"}\n", buf.String())
+
+	// truncated by depth
+	buf.Reset()
+	assert.NoError(tree.WriteDOT(&buf, ViewOptions[string]{MaxDepth: 1}))
+	assert.Equal("digraph llrb {\n"+
+		"\tgraph [ordering=out];\n"+
+		"\tnode [shape=circle, style=filled, fontcolor=white, fillcolor=black];\n"+
+		"\tn0 [label=\"B\"];\n"+
+		"\tn1 [label=\"...\", shape=plaintext, fontcolor=black, style=\"\"];\n"+
+		"\tn0 -> n1;\n"+
+		"}\n", buf.String())
+
+	// key range
+	buf.Reset()
+	assert.NoError(tree.WriteDOT(&buf, ViewOptions[string]{Span: true, Start: "0", End: "A"}))
+	assert.Equal("digraph llrb {\n"+
+		"\tgraph [ordering=out];\n"+
+		"\tnode [shape=circle, style=filled, fontcolor=white, fillcolor=black];\n"+
+		"\tn0 [label=\"A\"];\n"+
+		"\tn1 [label=\"0\", fillcolor=red];\n"+
+		"\tn0 -> n1 [color=red, penwidth=2];\n"+
+		"\tn2 [style=invis];\n"+
+		"\tn0 -> n2 [style=invis];\n"+
+		"}\n", buf.String())
+}
+
+func TestWriteMermaid(t *testing.T) {
+	if !LLRB234 {
+		return
+	}
+	title("Test WriteMermaid()")
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	tree := New[int]()
+	for _, k := range []int{1, 2, 3, 4, 5} {
+		tree.Put(k, k*10)
+	}
+	assert.NoError(tree.WriteMermaid(&buf, ViewOptions[int]{}))
+	assert.Equal("graph TD\n"+
+		"\tn0((\"2\"))\n"+
+		"\tn1((\"1\"))\n"+
+		"\tn0 --> n1\n"+
+		"\tn2((\"4\"))\n"+
+		"\tn0 --> n2\n"+
+		"\tn3((\"3\"))\n"+
+		"\tn2 --> n3\n"+
+		"\tn4((\"5\"))\n"+
+		"\tn2 --> n4\n"+
+		"\tclassDef red fill:#d22,stroke:#d22,color:#fff\n"+
+		"\tclassDef black fill:#222,stroke:#222,color:#fff\n"+
+		"\tclass n3,n4 red\n"+
+		"\tclass n0,n1,n2 black\n"+
+		"\tlinkStyle 2,3 stroke:#d22,stroke-width:2px\n", buf.String())
+
+	// values, parents and a range out of the left subtree
+	buf.Reset()
+	assert.NoError(tree.WriteMermaid(&buf, ViewOptions[int]{Values: true, Parents: true, Span: true, Start: 4, End: 9}))
+	assert.Equal("graph TD\n"+
+		"\tn0((\"4<br/>40\"))\n"+
+		"\tn2((\"5<br/>50\"))\n"+
+		"\tn0 --> n2\n"+
+		"\tn2 -.-> n0\n"+
+		"\tclassDef red fill:#d22,stroke:#d22,color:#fff\n"+
+		"\tclassDef black fill:#222,stroke:#222,color:#fff\n"+
+		"\tclass n2 red\n"+
+		"\tclass n0 black\n"+
+		"\tlinkStyle 0 stroke:#d22,stroke-width:2px\n", buf.String())
+}
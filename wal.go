@@ -0,0 +1,424 @@
+package gomapllrb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/constraints"
+)
+
+// SyncPolicy decides when the write-ahead log is flushed to the disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs on every write. (default)
+	SyncAlways SyncPolicy = iota
+	// SyncInterval syncs every WALOptions.SyncInterval, so a crash of the
+	// OS loses the writes since the last sync.
+	SyncInterval
+	// SyncNever leaves it to the OS.
+	SyncNever
+)
+
+// WALOptions configures the write-ahead log opened by OpenWAL().
+type WALOptions struct {
+	Sync            SyncPolicy
+	SyncInterval    time.Duration // for SyncInterval (default: 1s)
+	CompactInterval time.Duration // compact periodically, 0 disables it
+}
+
+// ErrTreeNotEmpty is returned by OpenWAL() if the tree has any key.
+var ErrTreeNotEmpty = errors.New("tree is not empty")
+
+// ErrWALClosed is returned by Compact() after Close().
+var ErrWALClosed = errors.New("wal is closed")
+
+// WAL is a write-ahead log of a tree, which appends each change of the tree
+// to the log files in a directory. Compact() writes the tree in a snapshot
+// file and removes the logs before it.
+//
+//	snapshot-00000003.jsonl  the tree before wal-00000003.jsonl
+//	wal-00000003.jsonl
+//	wal-00000004.jsonl       the log being written
+//
+// The logs are written by OpRecorder, so the values must be encodable in
+// JSON and they are restored as decoded by encoding/json, such as float64
+// for the numbers. The expiration times are not logged.
+type WAL[K constraints.Ordered] struct {
+	tree *Tree[K]
+	dir  string
+	opts WALOptions
+	rec  *OpRecorder[K]
+
+	mutex  sync.Mutex // protects the log file
+	file   *os.File   // log being written
+	seq    int        // sequence number of the log being written
+	err    error      // first error of the sync and the compaction
+	closed bool       // set by Close(), stops the compactions
+
+	compactMutex sync.Mutex // serializes the compactions
+	stop         chan struct{}
+	wg           sync.WaitGroup
+	closeOnce    sync.Once
+}
+
+// OpenWAL recovers the tree from the snapshot and the logs in the directory
+// and starts logging the changes of the tree. The tree must be empty and
+// configured with the comparator before.
+//
+// A log which ends in a partial line, written when the process crashed,
+// is truncated to the last complete line.
+//
+// The writes of the tree don't fail when the log can't be written, such as
+// on a full disk or a value not encodable in JSON. Logging stops at the
+// first error instead, and the tree keeps applying the changes, which are
+// not durable from then on. The error is logged by the logger set by
+// SetLogger() and returned by Err(), so check Err() after the important
+// writes.
+//
+//	tree := New[string]()
+//	wal, err := tree.OpenWAL("data", WALOptions{Sync: SyncInterval})
+//	defer wal.Close()
+func (tree *Tree[K]) OpenWAL(dir string, opts WALOptions) (*WAL[K], error) {
+	if tree.Len() > 0 {
+		return nil, ErrTreeNotEmpty
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	w := &WAL[K]{
+		tree: tree,
+		dir:  dir,
+		opts: opts,
+		stop: make(chan struct{}),
+	}
+	last, err := w.recover()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.openLog(last + 1); err != nil {
+		return nil, err
+	}
+	w.rec = NewOpRecorder[K](walWriter[K]{w}, true)
+	tree.SetRecorder(w.rec)
+
+	if opts.Sync == SyncInterval {
+		w.every(opts.SyncInterval, w.Sync)
+	}
+	if opts.CompactInterval > 0 {
+		w.every(opts.CompactInterval, w.Compact)
+	}
+	return w, nil
+}
+
+// Sync flushes the log to the disk.
+func (w *WAL[K]) Sync() error {
+	w.mutex.Lock()
+	err := w.file.Sync()
+	w.mutex.Unlock()
+	return w.setErr(err)
+}
+
+// Compact writes the tree in a new snapshot file and removes the older
+// snapshots and logs. The keys are copied in memory walking the whole tree
+// under the write lock, like a full Checkpoint(), and written after
+// releasing it. It returns ErrWALClosed after Close().
+func (w *WAL[K]) Compact() error {
+	w.compactMutex.Lock()
+	defer w.compactMutex.Unlock()
+
+	// switch to a new log at the point of the copy
+	type itemObj struct {
+		name K
+		data interface{}
+	}
+	var items []itemObj
+	w.tree.mutex.Lock()
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		w.tree.mutex.Unlock()
+		return ErrWALClosed
+	}
+	old := w.file
+	err := w.openLogLocked(w.seq + 1)
+	seq := w.seq
+	w.mutex.Unlock()
+	if err == nil {
+		items = make([]itemObj, 0, w.tree.len)
+		stack := make([]*Node[K], 0, 64)
+		for node := w.tree.root; node != nil || len(stack) > 0; {
+			for ; node != nil; node = node.left {
+				stack = append(stack, node)
+			}
+			node = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			items = append(items, itemObj{node.name, node.data})
+			node = node.right
+		}
+	}
+	w.tree.mutex.Unlock()
+	if err != nil {
+		return w.setErr(err)
+	}
+	if err := closeFile(old); err != nil {
+		return w.setErr(err)
+	}
+
+	// write the snapshot
+	tmp := filepath.Join(w.dir, walName("snapshot", seq)+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return w.setErr(err)
+	}
+	buf := bufio.NewWriter(f)
+	rec := NewOpRecorder[K](buf, true)
+	for _, item := range items {
+		rec.record(OpLogPut, item.name, item.data)
+	}
+	err = rec.Err()
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return w.setErr(err)
+	}
+	if err := closeFile(f); err != nil {
+		os.Remove(tmp)
+		return w.setErr(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(w.dir, walName("snapshot", seq))); err != nil {
+		return w.setErr(err)
+	}
+	if err := syncDir(w.dir); err != nil {
+		return w.setErr(err)
+	}
+	return w.setErr(w.removeBefore(seq))
+}
+
+// Err returns the first error of writing the logs, syncing them and the
+// compactions. The changes after the error may not be durable.
+func (w *WAL[K]) Err() error {
+	w.tree.mutex.RLock()
+	err := w.rec.Err()
+	w.tree.mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+// Close stops logging the changes of the tree and closes the log. Closing
+// again just returns Err().
+func (w *WAL[K]) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+		w.wg.Wait()
+		w.tree.SetRecorder(nil)
+		w.mutex.Lock()
+		w.closed = true
+		err := closeFile(w.file)
+		w.mutex.Unlock()
+		w.setErr(err)
+	})
+	return w.Err()
+}
+
+/*************************************************************************
+ * Write-ahead log functions
+ ************************************************************************/
+
+// walWriter writes the records to the log.
+type walWriter[K constraints.Ordered] struct {
+	w *WAL[K]
+}
+
+func (ww walWriter[K]) Write(p []byte) (int, error) {
+	w := ww.w
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	n, err := w.file.Write(p)
+	if err == nil && w.opts.Sync == SyncAlways {
+		err = w.file.Sync()
+	}
+	return n, err
+}
+
+// recover replays the latest snapshot and the logs after it, and returns
+// the last sequence number found.
+func (w *WAL[K]) recover() (int, error) {
+	snapshots, logs, err := w.list()
+	if err != nil {
+		return 0, err
+	}
+	last, base := 0, 0
+	if len(snapshots) > 0 {
+		base = snapshots[len(snapshots)-1]
+		last = base
+		if err := w.replayFile(walName("snapshot", base), false); err != nil {
+			return 0, err
+		}
+	}
+	for i, seq := range logs {
+		if seq > last {
+			last = seq
+		}
+		if seq < base {
+			continue
+		}
+		if err := w.replayFile(walName("wal", seq), i == len(logs)-1); err != nil {
+			return 0, err
+		}
+	}
+	return last, nil
+}
+
+// replayFile replays a file. The partial line at the end of the last log is
+// truncated.
+func (w *WAL[K]) replayFile(name string, last bool) error {
+	path := filepath.Join(w.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	offset, err := replay(bytes.NewReader(data), w.tree, nil)
+	if err == nil {
+		return nil
+	}
+	if !last || bytes.IndexByte(bytes.TrimLeft(data[offset:], "\n"), '\n') >= 0 {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return os.Truncate(path, offset)
+}
+
+// list returns the sequence numbers of the snapshots and the logs in order,
+// and removes the temporary files left by a crash.
+func (w *WAL[K]) list() ([]int, []int, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var snapshots, logs []int
+	for _, e := range entries {
+		var seq int
+		if _, err := fmt.Sscanf(e.Name(), "snapshot-%08d.jsonl", &seq); err == nil {
+			if e.Name() == walName("snapshot", seq) {
+				snapshots = append(snapshots, seq)
+			} else {
+				os.Remove(filepath.Join(w.dir, e.Name()))
+			}
+		} else if _, err := fmt.Sscanf(e.Name(), "wal-%08d.jsonl", &seq); err == nil && e.Name() == walName("wal", seq) {
+			logs = append(logs, seq)
+		}
+	}
+	sort.Ints(snapshots)
+	sort.Ints(logs)
+	return snapshots, logs, nil
+}
+
+// removeBefore removes the snapshots and the logs before the sequence.
+func (w *WAL[K]) removeBefore(seq int) error {
+	snapshots, logs, err := w.list()
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if s < seq {
+			if err := os.Remove(filepath.Join(w.dir, walName("snapshot", s))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range logs {
+		if s < seq {
+			if err := os.Remove(filepath.Join(w.dir, walName("wal", s))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *WAL[K]) openLog(seq int) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.openLogLocked(seq)
+}
+
+// openLogLocked starts a new log. The caller must hold w.mutex.
+func (w *WAL[K]) openLogLocked(seq int) error {
+	f, err := os.OpenFile(filepath.Join(w.dir, walName("wal", seq)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(w.dir); err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.seq = f, seq
+	return nil
+}
+
+// every calls fn periodically until closed.
+func (w *WAL[K]) every(d time.Duration, fn func() error) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// setErr keeps the first error.
+func (w *WAL[K]) setErr(err error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+func walName(kind string, seq int) string {
+	return fmt.Sprintf("%s-%08d.jsonl", kind, seq)
+}
+
+func closeFile(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,151 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWAL(t *testing.T) {
+	title("Test OpenWAL()")
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	files := func() []string {
+		var names []string
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	tree := New[int]()
+	wal, err := tree.OpenWAL(dir, WALOptions{})
+	assert.NoError(err)
+	for i := 0; i < 1000; i++ {
+		tree.Put(int(hash32(i)%500), fmt.Sprint(i))
+		tree.Delete(int(hash32(i+1) % 500))
+	}
+	assert.Equal([]string{"wal-00000001.jsonl"}, files())
+
+	// recover without closing, like after a crash
+	recovered := New[int]()
+	wal2, err := recovered.OpenWAL(dir, WALOptions{Sync: SyncNever})
+	assert.NoError(err)
+	assert.Equal(tree.String(), recovered.String())
+	assert.Equal(tree.Map(), recovered.Map())
+	assert.NoError(wal2.Close())
+	assert.NoError(wal.Close())
+	assert.Equal([]string{"wal-00000001.jsonl", "wal-00000002.jsonl"}, files())
+
+	// compaction
+	tree = New[int]()
+	wal, err = tree.OpenWAL(dir, WALOptions{Sync: SyncInterval, SyncInterval: time.Millisecond})
+	assert.NoError(err)
+	assert.Equal(recovered.Map(), tree.Map())
+	tree.Put(1000, "a")
+	assert.NoError(wal.Compact())
+	assert.Equal([]string{"snapshot-00000004.jsonl", "wal-00000004.jsonl"}, files())
+	tree.Put(1001, "b")
+	tree.Delete(1000)
+	tree.Clear()
+	tree.Put(1002, "c")
+	assert.NoError(wal.Compact())
+	tree.Put(1003, "d")
+	assert.NoError(wal.Close())
+	assert.Equal([]string{"snapshot-00000005.jsonl", "wal-00000005.jsonl"}, files())
+
+	recovered = New[int]()
+	wal, err = recovered.OpenWAL(dir, WALOptions{})
+	assert.NoError(err)
+	assert.Equal(map[int]interface{}{1002: "c", 1003: "d"}, recovered.Map())
+	assert.NoError(wal.Close())
+
+	// the partial line written by a crash
+	last := filepath.Join(dir, "wal-00000006.jsonl")
+	f, _ := os.OpenFile(last, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString(`{"op":"put","key":1004,"value":"e"}` + "\n" + `{"op":"put","ke`)
+	f.Close()
+	os.WriteFile(filepath.Join(dir, "snapshot-00000006.jsonl.tmp"), []byte("{"), 0o644)
+	recovered = New[int]()
+	wal, err = recovered.OpenWAL(dir, WALOptions{})
+	assert.NoError(err)
+	assert.Equal(map[int]interface{}{1002: "c", 1003: "d", 1004: "e"}, recovered.Map())
+	assert.NoError(wal.Close())
+	data, _ := os.ReadFile(last)
+	assert.Equal(`{"op":"put","key":1004,"value":"e"}`, string(data))
+	assert.NotContains(files(), "snapshot-00000006.jsonl.tmp")
+
+	// the corruption in the middle, the partial line is not the last
+	os.WriteFile(last, []byte(`{"op":"put","ke`), 0o644)
+	_, err = New[int]().OpenWAL(dir, WALOptions{})
+	assert.ErrorContains(err, "wal-00000006.jsonl: step 1: ")
+	os.WriteFile(last, data, 0o644)
+
+	// periodic compaction
+	tree = New[int]()
+	wal, err = tree.OpenWAL(dir, WALOptions{Sync: SyncNever, CompactInterval: time.Millisecond})
+	assert.NoError(err)
+	tree.Put(1005, "f")
+	// a compaction may be in progress, so the files are checked after close
+	assert.Eventually(func() bool {
+		names := files()
+		return len(names) > 0 && names[0] >= "snapshot-00000009.jsonl"
+	}, time.Second, time.Millisecond)
+	assert.NoError(wal.Close())
+	assert.Len(files(), 2)
+	recovered = New[int]()
+	wal, err = recovered.OpenWAL(dir, WALOptions{})
+	assert.NoError(err)
+	assert.Equal(map[int]interface{}{1002: "c", 1003: "d", 1004: "e", 1005: "f"}, recovered.Map())
+	assert.NoError(wal.Close())
+	assert.NoError(wal.Close()) // closing again
+	names := files()
+	assert.ErrorIs(wal.Compact(), ErrWALClosed)
+	assert.Equal(names, files())
+	assert.NoError(wal.Err())
+
+	// a write failure stops logging and is logged
+	var buf bytes.Buffer
+	tree = New[int]()
+	tree.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)), LogOptions{})
+	wal, err = tree.OpenWAL(t.TempDir(), WALOptions{})
+	assert.NoError(err)
+	tree.Put(1, func() {})
+	tree.Put(2, "b")
+	assert.Equal(2, tree.Len())
+	assert.Error(wal.Err())
+	assert.Contains(buf.String(), `level=ERROR msg="gomapllrb: recording stopped" op=put key=1 error=`)
+	assert.Error(wal.Close())
+	assert.Error(wal.Close())
+
+	// the string keys not in UTF-8, in the logs and the snapshots
+	strDir := t.TempDir()
+	strs := New[string]()
+	strWAL, err := strs.OpenWAL(strDir, WALOptions{})
+	assert.NoError(err)
+	strs.Put("\xff", 1)
+	strs.Put("\xfe", 2)
+	assert.NoError(strWAL.Close())
+	for i := 0; i < 2; i++ {
+		recoveredStrs := New[string]()
+		strWAL, err = recoveredStrs.OpenWAL(strDir, WALOptions{})
+		assert.NoError(err)
+		assert.Equal(map[string]interface{}{"\xfe": 2.0, "\xff": 1.0}, recoveredStrs.Map())
+		assert.NoError(strWAL.Compact())
+		assert.NoError(strWAL.Close())
+	}
+
+	// only to an empty tree
+	_, err = recovered.OpenWAL(dir, WALOptions{})
+	assert.ErrorIs(err, ErrTreeNotEmpty)
+}
@@ -0,0 +1,242 @@
+package gomapllrb
+
+import (
+	"sync"
+
+	"golang.org/x/exp/constraints"
+)
+
+// EventType is the type of a change event.
+type EventType int
+
+const (
+	// EventPut is sent when a new key is inserted.
+	EventPut EventType = iota
+	// EventUpdate is sent when the value of an existing key is replaced.
+	EventUpdate
+	// EventDelete is sent when a key is deleted, expired, evicted or
+	// cleared.
+	EventDelete
+)
+
+// Event is a change notification delivered to the watchers.
+// Old is nil for EventPut and New is nil for EventDelete.
+type Event[K constraints.Ordered] struct {
+	Type EventType
+	Key  K
+	Old  interface{}
+	New  interface{}
+}
+
+// DropPolicy decides what to do when a watcher's buffer is full.
+type DropPolicy int
+
+const (
+	// DropNewest discards the new event. (default)
+	DropNewest DropPolicy = iota
+	// DropOldest discards the oldest event in the buffer to make room.
+	DropOldest
+	// Block waits until the watcher receives the event or cancels the
+	// watch. It blocks the writers meanwhile.
+	Block
+)
+
+// WatchOption configures a watcher in Watch().
+type WatchOption func(*watchOptions)
+
+type watchOptions struct {
+	buffer int
+	policy DropPolicy
+}
+
+// WithWatchBuffer sets the channel buffer size of a watcher. (default: 64)
+func WithWatchBuffer(n int) WatchOption {
+	return func(o *watchOptions) {
+		o.buffer = n
+	}
+}
+
+// WithDropPolicy sets the policy applied when a watcher's buffer is full.
+func WithDropPolicy(policy DropPolicy) WatchOption {
+	return func(o *watchOptions) {
+		o.policy = policy
+	}
+}
+
+// Watch returns a channel delivering the changes of the keys within the
+// range lo <= key <= hi, and a function to cancel the watch which closes
+// the channel. Events are sent by the writers, so a slow watcher loses
+// events according to the drop policy instead of blocking the writers.
+func (tree *Tree[K]) Watch(lo, hi K, opts ...WatchOption) (<-chan Event[K], func()) {
+	o := watchOptions{buffer: 64}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	w := &watcher[K]{
+		lo:     lo,
+		hi:     hi,
+		ch:     make(chan Event[K], o.buffer),
+		done:   make(chan struct{}),
+		policy: o.policy,
+	}
+
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	n := tree.notifier()
+	n.watchers = append(n.watchers, w)
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			// release the writer blocked in deliver() before locking
+			close(w.done)
+			tree.mutex.Lock()
+			defer tree.mutex.Unlock()
+			for i, v := range n.watchers {
+				if v == w {
+					n.watchers = append(n.watchers[:i], n.watchers[i+1:]...)
+					close(w.ch)
+					break
+				}
+			}
+		})
+	}
+	return w.ch, cancel
+}
+
+// OnPut sets a hook function called when a key is inserted or updated.
+// The found argument is true if the key existed. The hook is called
+// synchronously under the write lock, so it must not access the tree.
+func (tree *Tree[K]) OnPut(fn func(name K, old, data interface{}, found bool)) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.notifier().onPut = fn
+}
+
+// OnDelete sets a hook function called when a key is deleted, expired,
+// evicted or cleared by Clear(). The hook is called synchronously under
+// the write lock, so it must not access the tree.
+func (tree *Tree[K]) OnDelete(fn func(name K, data interface{})) {
+	tree.mutex.Lock()
+	defer tree.mutex.Unlock()
+	tree.notifier().onDelete = fn
+}
+
+/*************************************************************************
+ * Notification delivery
+ ************************************************************************/
+
+type notifier[K constraints.Ordered] struct {
+	onPut    func(name K, old, data interface{}, found bool)
+	onDelete func(name K, data interface{})
+	watchers []*watcher[K]
+}
+
+type watcher[K constraints.Ordered] struct {
+	lo     K
+	hi     K
+	ch     chan Event[K]
+	done   chan struct{} // closed when cancelled
+	policy DropPolicy
+}
+
+func (tree *Tree[K]) notifier() *notifier[K] {
+	if tree.notify == nil {
+		tree.notify = &notifier[K]{}
+	}
+	return tree.notify
+}
+
+// notifyPut notifies a put. The caller must hold the write lock.
+func (tree *Tree[K]) notifyPut(name K, old, data interface{}, found bool) {
+	n := tree.notify
+	if n.onPut != nil {
+		n.onPut(name, old, data, found)
+	}
+	if len(n.watchers) > 0 {
+		ev := Event[K]{Type: EventPut, Key: name, New: data}
+		if found {
+			ev.Type = EventUpdate
+			ev.Old = old
+		}
+		tree.send(ev)
+	}
+}
+
+// notifyDelete notifies a deletion. The caller must hold the write lock.
+func (tree *Tree[K]) notifyDelete(name K, data interface{}) {
+	n := tree.notify
+	if n.onDelete != nil {
+		n.onDelete(name, data)
+	}
+	if len(n.watchers) > 0 {
+		tree.send(Event[K]{Type: EventDelete, Key: name, Old: data})
+	}
+}
+
+// notifyClear notifies the deletion of the keys before the tree is
+// cleared. Only the keys within the watched ranges are visited unless the
+// OnDelete hook is set. The caller must hold the write lock.
+func (tree *Tree[K]) notifyClear() {
+	n := tree.notify
+	if n.onDelete == nil && len(n.watchers) == 0 {
+		return
+	}
+	it := &Iter[K]{
+		tree: tree,
+		cur:  findMin(tree.root),
+	}
+	if n.onDelete == nil {
+		lo, hi := n.watchers[0].lo, n.watchers[0].hi
+		for _, w := range n.watchers[1:] {
+			if tree.isLess(w.lo, lo) {
+				lo = w.lo
+			}
+			if tree.isLess(hi, w.hi) {
+				hi = w.hi
+			}
+		}
+		it.cur = tree.bigger(tree.root, lo, true)
+		it.end, it.span = hi, true
+	}
+	for it.track(); it.next(); {
+		tree.notifyDelete(it.last.name, it.last.data)
+	}
+}
+
+func (tree *Tree[K]) send(ev Event[K]) {
+	for _, w := range tree.notify.watchers {
+		if tree.isLess(ev.Key, w.lo) || tree.isLess(w.hi, ev.Key) {
+			continue
+		}
+		w.deliver(ev)
+	}
+}
+
+func (w *watcher[K]) deliver(ev Event[K]) {
+	switch w.policy {
+	case Block:
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+		}
+		return
+	case DropOldest:
+		for cap(w.ch) > 0 {
+			select {
+			case w.ch <- ev:
+				return
+			default:
+			}
+			// make room and try again
+			select {
+			case <-w.ch:
+			default:
+			}
+		}
+	}
+	select {
+	case w.ch <- ev:
+	default:
+	}
+}
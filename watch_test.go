@@ -0,0 +1,185 @@
+//go:build !bench
+
+package gomapllrb
+
+import (
+	"cmp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	title("Test Watch()")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	ch, cancel := tree.Watch(10, 20)
+	tree.Put(5, "a")
+	tree.Put(10, "b")
+	tree.Put(10, "c")
+	tree.Put(20, "d")
+	tree.Delete(10)
+	tree.Delete(5)
+	tree.Put(21, "e")
+	cancel()
+	cancel() // no harm
+
+	var events []Event[int]
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	assert.Equal([]Event[int]{
+		{Type: EventPut, Key: 10, New: "b"},
+		{Type: EventUpdate, Key: 10, Old: "b", New: "c"},
+		{Type: EventPut, Key: 20, New: "d"},
+		{Type: EventDelete, Key: 10, Old: "c"},
+	}, events)
+
+	// no more events after cancel
+	tree.Put(15, "f")
+}
+
+func TestWatchStoredKey(t *testing.T) {
+	title("Test Watch() reports the keys stored")
+	assert := assert.New(t)
+
+	tree := New[string]()
+	tree.SetCompare(func(a, b string) int { return cmp.Compare(strings.ToLower(a), strings.ToLower(b)) })
+	var deleted []string
+	tree.OnDelete(func(name string, data interface{}) {
+		deleted = append(deleted, name)
+	})
+	ch, cancel := tree.Watch("a", "z")
+	tree.Put("abc", 1)
+	tree.Put("Abc", 2)
+	tree.Delete("ABC")
+	cancel()
+
+	var events []Event[string]
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	assert.Equal([]Event[string]{
+		{Type: EventPut, Key: "abc", New: 1},
+		{Type: EventUpdate, Key: "abc", Old: 1, New: 2},
+		{Type: EventDelete, Key: "abc", Old: 2},
+	}, events)
+	assert.Equal([]string{"abc"}, deleted)
+}
+
+func TestWatchClear(t *testing.T) {
+	title("Test Watch() and OnDelete() on Clear()")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	for i := 0; i < 10; i++ {
+		tree.Put(i, i*10)
+	}
+	ch1, cancel1 := tree.Watch(2, 3)
+	ch2, cancel2 := tree.Watch(7, 20)
+	tree.Clear()
+	cancel1()
+	cancel2()
+
+	var events []Event[int]
+	for ev := range ch1 {
+		events = append(events, ev)
+	}
+	for ev := range ch2 {
+		events = append(events, ev)
+	}
+	assert.Equal([]Event[int]{
+		{Type: EventDelete, Key: 2, Old: 20},
+		{Type: EventDelete, Key: 3, Old: 30},
+		{Type: EventDelete, Key: 7, Old: 70},
+		{Type: EventDelete, Key: 8, Old: 80},
+		{Type: EventDelete, Key: 9, Old: 90},
+	}, events)
+
+	// every key to the hook
+	var keys []int
+	tree.OnDelete(func(name int, data interface{}) {
+		keys = append(keys, name)
+	})
+	tree.Put(1, nil)
+	tree.Put(2, nil)
+	tree.Clear()
+	assert.Equal([]int{1, 2}, keys)
+}
+
+func TestWatchDropPolicy(t *testing.T) {
+	title("Test Watch() drop policies")
+	assert := assert.New(t)
+
+	tree := New[int]()
+	newest, cancel1 := tree.Watch(0, 100, WithWatchBuffer(2))
+	oldest, cancel2 := tree.Watch(0, 100, WithWatchBuffer(2), WithDropPolicy(DropOldest))
+	for i := 1; i <= 5; i++ {
+		tree.Put(i, i)
+	}
+	cancel1()
+	cancel2()
+
+	var keys []int
+	for ev := range newest {
+		keys = append(keys, ev.Key)
+	}
+	assert.Equal([]int{1, 2}, keys)
+	keys = nil
+	for ev := range oldest {
+		keys = append(keys, ev.Key)
+	}
+	assert.Equal([]int{4, 5}, keys)
+
+	// blocking watcher
+	blocking, cancel := tree.Watch(0, 100, WithWatchBuffer(0), WithDropPolicy(Block))
+	done := make(chan struct{})
+	go func() {
+		tree.Put(6, 6)
+		close(done)
+	}()
+	ev := <-blocking
+	assert.Equal(6, ev.Key)
+	<-done
+
+	// cancelling releases the writer blocked on it
+	done = make(chan struct{})
+	go func() {
+		tree.Put(7, 7)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+	cancel()
+	_, ok := <-blocking
+	assert.False(ok)
+}
+
+func TestHooks(t *testing.T) {
+	title("Test OnPut() and OnDelete() hooks")
+	assert := assert.New(t)
+
+	tree := New[int](WithMaxLen(2))
+	var puts, deletes []int
+	tree.OnPut(func(name int, old, data interface{}, found bool) {
+		assert.Equal(name, data)
+		assert.Equal(found, old != nil)
+		puts = append(puts, name)
+	})
+	tree.OnDelete(func(name int, data interface{}) {
+		assert.Equal(name, data)
+		deletes = append(deletes, name)
+	})
+	tree.Put(1, 1)
+	tree.Put(1, 1)
+	tree.Put(2, 2)
+	tree.Put(3, 3) // evicts 1
+	tree.Delete(2)
+	tree.Delete(2)
+	assert.Equal([]int{1, 1, 2, 3}, puts)
+	assert.Equal([]int{1, 2}, deletes)
+}